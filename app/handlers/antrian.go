@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// kolomRuangPoli adalah kolom select ruang poli pasien: ruang hasil pindah jika ada,
+// selain itu ruang poli dokter
+const kolomRuangPoli = "COALESCE(bw_pindah_ruang_poli.kd_ruang_poli, bw_ruangpoli_dokter.kd_ruang_poli) AS kd_ruang_poli"
+
+// queryAntrian membangun query dasar antrian pasien hari ini pada ruang poli tertentu.
+// Ruang poli pasien mengikuti ruang poli dokter kecuali pasien dipindahkan (bw_pindah_ruang_poli).
+// Nomor antrian rumah sakit tersedia melalui kolomNomorAntrian.
+func queryAntrian(db *gorm.DB, kdRuangPoli string) *gorm.DB {
+	return queryAntrianRuang(db, []string{kdRuangPoli})
+}
+
+// queryAntrianRuang sama dengan queryAntrian untuk beberapa ruang poli sekaligus.
+// Sertakan kolomRuangPoli pada select untuk mengelompokkan hasil per ruang poli.
+func queryAntrianRuang(db *gorm.DB, kdRuangPoliList []string) *gorm.DB {
+	hari := services.GetDayList()[time.Now().Format("Monday")]
+
+	return db.Table("reg_periksa").
+		Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
+		Joins("JOIN (?) AS jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter", services.QueryJadwalDokter(db)).
+		Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
+		Joins("LEFT JOIN bw_pindah_ruang_poli ON reg_periksa.no_rawat = bw_pindah_ruang_poli.no_rawat").
+		Joins("LEFT JOIN bw_prioritas_pasien ON reg_periksa.no_rawat = bw_prioritas_pasien.no_rawat").
+		Joins("LEFT JOIN bw_nomor_antrian ON reg_periksa.no_rawat = bw_nomor_antrian.no_rawat").
+		Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
+		Where("jadwal.hari_kerja = ?", hari).
+		Where("(bw_pindah_ruang_poli.kd_ruang_poli IN ? OR (bw_pindah_ruang_poli.no_rawat IS NULL AND bw_ruangpoli_dokter.kd_ruang_poli IN ?))",
+			kdRuangPoliList, kdRuangPoliList)
+}
+
+// urutkanAntrian menerapkan urutan antrian standar: jam mulai praktek, nomor registrasi, lalu jam registrasi
+func urutkanAntrian(query *gorm.DB) *gorm.DB {
+	return query.
+		Order("jadwal.jam_mulai asc").
+		Order("reg_periksa.no_reg asc").
+		Order("reg_periksa.jam_reg asc")
+}
+
+// queryMenunggu membangun query pasien yang menunggu dipanggil: belum memiliki log antrian
+// atau sudah dikembalikan ke antrian (status=3). Pasien yang dikembalikan dan sudah habis
+// jatah lewatinya didahulukan, sedangkan yang masih menunggu giliran ditempatkan setelah pasien biasa.
+func queryMenunggu(db *gorm.DB, kdRuangPoli string) *gorm.DB {
+	return queryAntrian(db, kdRuangPoli).
+		Joins("LEFT JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
+		Where("(bw_log_antrian_poli.no_rawat IS NULL OR bw_log_antrian_poli.status = '3')").
+		Order(urutanMenunggu)
+}
+
+// urutanMenunggu mengurutkan pasien menunggu: pasien dikembalikan yang sudah habis jatah lewatinya,
+// pasien yang belum dipanggil, lalu pasien dikembalikan yang masih menunggu giliran
+const urutanMenunggu = "CASE WHEN bw_log_antrian_poli.status = '3' AND bw_log_antrian_poli.sisa_lewati <= 0 THEN 0 " +
+	"WHEN bw_log_antrian_poli.no_rawat IS NULL THEN 1 ELSE 2 END"
+
+// kolomDidahulukan adalah kolom select penanda pasien dikembalikan yang harus dipanggil lebih dulu
+const kolomDidahulukan = "COALESCE(bw_log_antrian_poli.status = '3' AND bw_log_antrian_poli.sisa_lewati <= 0, 0) AS didahulukan"
+
+// kolomPrioritas membangun kolom select jenis_prioritas dari aturan prioritas yang terdaftar.
+// Nilainya kosong untuk pasien reguler. Query harus memuat tabel reg_periksa, pasien, dan bw_prioritas_pasien.
+func kolomPrioritas(db *gorm.DB) (string, []interface{}) {
+	var aturan []models.AturanPrioritas
+	db.Order("id asc").Find(&aturan)
+
+	kolom := "CASE"
+	var args []interface{}
+	for _, a := range aturan {
+		switch a.Jenis {
+		case models.PrioritasLansia:
+			kolom += " WHEN TIMESTAMPDIFF(YEAR, pasien.tgl_lahir, CURDATE()) >= ? THEN ?"
+			args = append(args, toInt(a.Nilai), a.Jenis)
+		case models.PrioritasPenjab:
+			kolom += " WHEN reg_periksa.kd_pj = ? THEN ?"
+			args = append(args, a.Nilai, a.Jenis)
+		case models.PrioritasDisabilitas, models.PrioritasHamil:
+			kolom += " WHEN bw_prioritas_pasien.jenis = ? THEN ?"
+			args = append(args, a.Jenis, a.Jenis)
+		}
+	}
+
+	if len(args) == 0 {
+		return "'' AS jenis_prioritas", nil
+	}
+	return kolom + " ELSE '' END AS jenis_prioritas", args
+}
+
+// jenisPrioritasPasien mendapatkan jenis prioritas satu pasien, kosong jika pasien reguler
+func jenisPrioritasPasien(db *gorm.DB, noRawat string) (string, error) {
+	kolom, args := kolomPrioritas(db)
+
+	var hasil []map[string]interface{}
+	err := db.Table("reg_periksa").
+		Select(kolom, args...).
+		Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
+		Joins("LEFT JOIN bw_prioritas_pasien ON reg_periksa.no_rawat = bw_prioritas_pasien.no_rawat").
+		Where("reg_periksa.no_rawat = ?", noRawat).
+		Limit(1).
+		Find(&hasil).Error
+	if err != nil || len(hasil) == 0 {
+		return "", err
+	}
+
+	return stringValue(hasil[0]["jenis_prioritas"]), nil
+}
+
+// regulerSejakPrioritas menghitung pasien reguler yang dipanggil hari ini sejak panggilan prioritas terakhir
+func regulerSejakPrioritas(db *gorm.DB, kdRuangPoli string) (int, error) {
+	jumlah, err := regulerSejakPrioritasRuang(db, []string{kdRuangPoli})
+	return jumlah[kdRuangPoli], err
+}
+
+// regulerSejakPrioritasRuang menghitung regulerSejakPrioritas untuk beberapa ruang poli sekaligus
+// dalam satu query. Ruang poli tanpa panggilan reguler tidak memiliki entri pada hasil.
+func regulerSejakPrioritasRuang(db *gorm.DB, kdRuangPoliList []string) (map[string]int, error) {
+	hasil := make(map[string]int, len(kdRuangPoliList))
+	if len(kdRuangPoliList) == 0 {
+		return hasil, nil
+	}
+
+	awal := awalHariIni()
+	prioritasTerakhir := db.Model(&models.RiwayatPanggilan{}).
+		Select("kd_ruang_poli, MAX(waktu_panggil) AS waktu_terakhir").
+		Where("kd_ruang_poli IN ? AND prioritas = ? AND waktu_panggil >= ?", kdRuangPoliList, true, awal).
+		Group("kd_ruang_poli")
+
+	var rows []map[string]interface{}
+	err := db.Table("bw_riwayat_panggilan").
+		Select("bw_riwayat_panggilan.kd_ruang_poli, COUNT(*) AS jumlah").
+		Joins("LEFT JOIN (?) AS prioritas_terakhir ON prioritas_terakhir.kd_ruang_poli = bw_riwayat_panggilan.kd_ruang_poli", prioritasTerakhir).
+		Where("bw_riwayat_panggilan.kd_ruang_poli IN ? AND bw_riwayat_panggilan.prioritas = ? AND bw_riwayat_panggilan.panggilan_ke = 1 AND bw_riwayat_panggilan.waktu_panggil >= ?",
+			kdRuangPoliList, false, awal).
+		Where("(prioritas_terakhir.waktu_terakhir IS NULL OR bw_riwayat_panggilan.waktu_panggil > prioritas_terakhir.waktu_terakhir)").
+		Group("bw_riwayat_panggilan.kd_ruang_poli").
+		Find(&rows).Error
+	if err != nil {
+		return hasil, err
+	}
+
+	for _, row := range rows {
+		hasil[fmt.Sprint(row["kd_ruang_poli"])] = toInt(row["jumlah"])
+	}
+	return hasil, nil
+}
+
+// susunAntrian menyusun urutan giliran panggil dari pasien menunggu yang sudah diurutkan queryMenunggu.
+// Pasien yang didahulukan (dikembalikan ke antrian) tetap di depan, lalu satu pasien prioritas
+// diselipkan setiap selang pasien reguler. regulerTerakhir adalah jumlah pasien reguler yang sudah
+// dipanggil sejak pasien prioritas terakhir.
+func susunAntrian(menunggu []map[string]interface{}, selang, regulerTerakhir int) []map[string]interface{} {
+	hasil := make([]map[string]interface{}, 0, len(menunggu))
+	var reguler, prioritas []map[string]interface{}
+	for _, pasien := range menunggu {
+		switch {
+		case toInt(pasien["didahulukan"]) == 1:
+			hasil = append(hasil, pasien)
+		case selang > 0 && stringValue(pasien["jenis_prioritas"]) != "":
+			prioritas = append(prioritas, pasien)
+		default:
+			reguler = append(reguler, pasien)
+		}
+	}
+
+	for len(reguler) > 0 || len(prioritas) > 0 {
+		if len(prioritas) > 0 && (regulerTerakhir >= selang || len(reguler) == 0) {
+			hasil = append(hasil, prioritas[0])
+			prioritas = prioritas[1:]
+			regulerTerakhir = 0
+			continue
+		}
+		hasil = append(hasil, reguler[0])
+		reguler = reguler[1:]
+		regulerTerakhir++
+	}
+
+	return hasil
+}
+
+// daftarMenunggu mengambil pasien yang menunggu pada ruang poli tertentu sesuai urutan giliran panggil.
+// kolom berisi kolom select tambahan; jenis_prioritas dan didahulukan selalu disertakan.
+func daftarMenunggu(db *gorm.DB, kdRuangPoli, kolom string) ([]map[string]interface{}, error) {
+	kolomJenis, args := kolomPrioritas(db)
+
+	var menunggu []map[string]interface{}
+	err := urutkanAntrian(queryMenunggu(db, kdRuangPoli)).
+		Select(kolom+", "+kolomJenis+", "+kolomDidahulukan, args...).
+		Find(&menunggu).Error
+	if err != nil {
+		return nil, err
+	}
+
+	selang := getPengaturanRuangPoli(db, kdRuangPoli).SelangPrioritas
+	regulerTerakhir, err := regulerSejakPrioritas(db, kdRuangPoli)
+	if err != nil {
+		return nil, err
+	}
+
+	return susunAntrian(menunggu, selang, regulerTerakhir), nil
+}
+
+// kembalikanKeAntrian mengembalikan pasien terlewat ke antrian (status=3) sesuai pengaturan ruang poli
+// dan mengembalikan jumlah pasien yang akan dipanggil lebih dulu
+func kembalikanKeAntrian(db *gorm.DB, noRawat, kdRuangPoli string, pengaturan models.PengaturanRuangPoli) (int, error) {
+	sisaLewati := pengaturan.JumlahSisip
+	if pengaturan.KebijakanTerlewat == models.KebijakanTerlewatAkhir {
+		jumlahMenunggu, err := hitungMenunggu(db, kdRuangPoli)
+		if err != nil {
+			return 0, err
+		}
+		sisaLewati = jumlahMenunggu
+	}
+
+	return sisaLewati, sisipkanAntrian(db, noRawat, kdRuangPoli, sisaLewati)
+}
+
+// hitungMenunggu menghitung pasien yang belum pernah dipanggil pada ruang poli tertentu
+func hitungMenunggu(db *gorm.DB, kdRuangPoli string) (int, error) {
+	var jumlahMenunggu int64
+	err := queryAntrian(db, kdRuangPoli).
+		Where("NOT EXISTS (SELECT 1 FROM bw_log_antrian_poli WHERE reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat)").
+		Count(&jumlahMenunggu).Error
+
+	return int(jumlahMenunggu), err
+}
+
+// sisipkanAntrian menempatkan pasien ke antrian ruang poli (status=3) setelah sisaLewati panggilan berikutnya
+func sisipkanAntrian(db *gorm.DB, noRawat, kdRuangPoli string, sisaLewati int) error {
+	return db.Exec(`
+		INSERT INTO bw_log_antrian_poli (no_rawat, kd_ruang_poli, status, sisa_lewati, jumlah_panggil)
+		VALUES (?, ?, '3', ?, 0)
+		ON DUPLICATE KEY UPDATE kd_ruang_poli = ?, status = '3', sisa_lewati = ?, jumlah_panggil = 0
+	`, noRawat, kdRuangPoli, sisaLewati, kdRuangPoli, sisaLewati).Error
+}
+
+// terapkanKebijakanTerlewat dijalankan setelah pasien ditandai terlewat (status=1).
+// Jika ruang poli tidak memakai kebijakan manual, pasien langsung dikembalikan ke antrian.
+// Mengembalikan status akhir pasien.
+func terapkanKebijakanTerlewat(db *gorm.DB, noRawat, kdRuangPoli string) (string, error) {
+	pengaturan := getPengaturanRuangPoli(db, kdRuangPoli)
+	if pengaturan.KebijakanTerlewat == models.KebijakanTerlewatManual {
+		return "1", nil
+	}
+
+	if _, err := kembalikanKeAntrian(db, noRawat, kdRuangPoli, pengaturan); err != nil {
+		return "1", err
+	}
+	return "3", nil
+}
+
+// tandaiTerlewat memindahkan pasien yang sedang dipanggil (status=2) di ruang poli ke daftar terlewat (1)
+// lalu menerapkan kebijakan terlewat ruang poli pada masing-masing pasien. Jumlah panggilannya tetap
+// disimpan agar batas panggilan tetap berlaku. Harus dipanggil di dalam transaksi setelah kunciRuangPoli.
+func tandaiTerlewat(tx *gorm.DB, kdRuangPoli string, noRawat []string) error {
+	if len(noRawat) == 0 {
+		return nil
+	}
+
+	err := tx.Exec(`
+		UPDATE bw_log_antrian_poli SET status = '1', batas_dipanggil = NULL
+		WHERE kd_ruang_poli = ? AND status = '2' AND no_rawat IN ?
+	`, kdRuangPoli, noRawat).Error
+	if err != nil {
+		return err
+	}
+
+	for _, nr := range noRawat {
+		if _, err := terapkanKebijakanTerlewat(tx, nr, kdRuangPoli); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errPanggilanBentrok dikembalikan jika panggilan lain lebih dulu diproses
+var errPanggilanBentrok = errors.New("panggilan lain pada ruang poli ini sudah diproses lebih dulu")
+
+// errRuangTidakDitemukan dikembalikan jika ruang poli yang akan dikunci tidak ada
+var errRuangTidakDitemukan = errors.New("ruang poli tidak ditemukan")
+
+// errAntrianKosong dikembalikan jika tidak ada pasien yang bisa dipanggil
+var errAntrianKosong = errors.New("tidak ada pasien yang bisa dipanggil")
+
+// kunciRuangPoli mengunci baris ruang poli sehingga panggilan pada ruang yang sama diproses bergantian.
+// Mengembalikan errRuangTidakDitemukan jika ruang poli tidak ada. Harus dipanggil di dalam transaksi.
+func kunciRuangPoli(tx *gorm.DB, kdRuangPoli string) error {
+	var kunci []map[string]interface{}
+	err := tx.Table("bw_ruang_poli").
+		Select("kd_ruang_poli").
+		Where("kd_ruang_poli = ?", kdRuangPoli).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Find(&kunci).Error
+	if err != nil {
+		return err
+	}
+	if len(kunci) == 0 {
+		return errRuangTidakDitemukan
+	}
+	return nil
+}
+
+// pastikanPanggilanTerkini memeriksa bahwa pasien yang sedang dipanggil (status=2) di ruang poli masih
+// sama dengan yang dilihat client, sehingga dua petugas yang menekan tombol bersamaan tidak memanggil
+// dua pasien berbeda. harapan kosong berarti tidak ada pasien yang sedang dipanggil; nil berarti client
+// tidak mengirim harapan sehingga tidak diperiksa. Harus dipanggil setelah kunciRuangPoli.
+func pastikanPanggilanTerkini(tx *gorm.DB, kdRuangPoli string, harapan *string) error {
+	if harapan == nil {
+		return nil
+	}
+
+	var dipanggil []string
+	err := tx.Table("bw_log_antrian_poli").
+		Where("kd_ruang_poli = ? AND status = '2'", kdRuangPoli).
+		Pluck("no_rawat", &dipanggil).Error
+	if err != nil {
+		return err
+	}
+
+	sekarang := ""
+	if len(dipanggil) > 0 {
+		sekarang = dipanggil[0]
+	}
+	if sekarang != *harapan {
+		return errPanggilanBentrok
+	}
+	return nil
+}
+
+// catatPanggilan menandai pasien sedang dipanggil (status=2), mencatat riwayat panggilan,
+// dan mengisi jumlah panggilan pada msg. Harus dipanggil di dalam transaksi setelah kunciRuangPoli.
+func catatPanggilan(tx *gorm.DB, msg *PanggilPoliMessage, noRawat string) error {
+	// Ruang poli yang sedang dijeda tidak dapat memanggil pasien
+	if err := pastikanRuangAktif(tx, msg.KdRuangPoli); err != nil {
+		return err
+	}
+
+	// Kunci log pasien dan periksa apakah pasien sedang dipanggil di ruang lain
+	var logLama []models.LogAntrianPoli
+	err := tx.Where("no_rawat = ?", noRawat).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Find(&logLama).Error
+	if err != nil {
+		return err
+	}
+
+	statusLama := ""
+	if len(logLama) > 0 {
+		statusLama = logLama[0].Status
+		if statusLama == "2" && logLama[0].KdRuangPoli != msg.KdRuangPoli {
+			return errPanggilanBentrok
+		}
+	}
+
+	// Panggilan pasien baru (bukan panggil ulang) mengurangi jatah lewati pasien yang dikembalikan ke antrian
+	if statusLama != "2" {
+		err = tx.Exec(`
+			UPDATE bw_log_antrian_poli SET sisa_lewati = sisa_lewati - 1
+			WHERE kd_ruang_poli = ? AND status = '3' AND sisa_lewati > 0 AND no_rawat <> ?
+		`, msg.KdRuangPoli, noRawat).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// Pasien lain yang masih dipanggil di poli yang sama akan dipindahkan ke daftar terlewat
+	var dipanggilLain []string
+	err = tx.Table("bw_log_antrian_poli").
+		Where("kd_ruang_poli = ? AND status = '2' AND no_rawat <> ?", msg.KdRuangPoli, noRawat).
+		Pluck("no_rawat", &dipanggilLain).Error
+	if err != nil {
+		return err
+	}
+
+	// Tambahkan status baru untuk pasien yang dipanggil, hitung jumlah panggilannya,
+	// dan tentukan kapan status panggilan berakhir. Panggilan baru menggantikan batas sebelumnya.
+	batasPanggilan := getPengaturanRuangPoli(tx, msg.KdRuangPoli).BatasPanggilan
+	batasDipanggil := time.Now().Add(time.Duration(batasPanggilan) * time.Minute)
+	err = tx.Exec(`
+		INSERT INTO bw_log_antrian_poli (no_rawat, kd_ruang_poli, status, jumlah_panggil, batas_dipanggil)
+		VALUES (?, ?, '2', 1, ?)
+		ON DUPLICATE KEY UPDATE kd_ruang_poli = ?, status = '2', jumlah_panggil = jumlah_panggil + 1, batas_dipanggil = ?
+	`, noRawat, msg.KdRuangPoli, batasDipanggil, msg.KdRuangPoli, batasDipanggil).Error
+	if err != nil {
+		return err
+	}
+
+	// Kebijakan terlewat diterapkan setelah pasien baru tercatat agar tidak ikut dihitung menunggu
+	if err := tandaiTerlewat(tx, msg.KdRuangPoli, dipanggilLain); err != nil {
+		return err
+	}
+
+	err = tx.Table("bw_log_antrian_poli").
+		Select("jumlah_panggil").
+		Where("no_rawat = ?", noRawat).
+		Row().
+		Scan(&msg.JumlahPanggil)
+	if err != nil {
+		return err
+	}
+
+	msg.JenisPrioritas, err = jenisPrioritasPasien(tx, noRawat)
+	if err != nil {
+		return err
+	}
+	msg.Prioritas = msg.JenisPrioritas != ""
+
+	nomor, err := buatNomorAntrian(tx, noRawat, msg.KdRuangPoli)
+	if err != nil {
+		return err
+	}
+	msg.NoAntrian = nomor.KodeAntrian
+
+	// Catat riwayat panggilan
+	return tx.Create(&models.RiwayatPanggilan{
+		NoRawat:      noRawat,
+		KdRuangPoli:  msg.KdRuangPoli,
+		KdDisplay:    msg.KdDisplay,
+		NoReg:        msg.NoReg,
+		NoAntrian:    msg.NoAntrian,
+		NmPasien:     msg.NmPasien,
+		NmPoli:       msg.NmPoli,
+		PanggilanKe:  msg.JumlahPanggil,
+		Prioritas:    msg.Prioritas,
+		WaktuPanggil: time.Now(),
+	}).Error
+}
+
+// toInt mengubah nilai kolom hasil query map menjadi int, 0 jika tidak valid
+func toInt(value interface{}) int {
+	n, _ := strconv.Atoi(fmt.Sprint(value))
+	return n
+}
+
+// stringValue mengubah nilai kolom hasil query map menjadi string, kosong jika NULL
+func stringValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// awalHariIni mengembalikan waktu pukul 00:00 hari ini
+func awalHariIni() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
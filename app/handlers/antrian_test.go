@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// cariQuery mengembalikan indeks query pertama yang memuat teks tertentu, -1 jika tidak ada
+func cariQuery(query []string, memuat string) int {
+	for i, q := range query {
+		if strings.Contains(q, memuat) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestKunciRuangPoli(t *testing.T) {
+	tests := []struct {
+		name  string
+		hasil []hasilPalsu
+		err   error
+	}{
+		{
+			name: "ruang poli ada",
+			hasil: []hasilPalsu{{
+				memuat: "FROM `bw_ruang_poli`",
+				kolom:  []string{"kd_ruang_poli"},
+				baris:  [][]driver.Value{{"R1"}},
+			}},
+		},
+		{name: "ruang poli tidak ada", err: errRuangTidakDitemukan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			if err := kunciRuangPoli(db, "R1"); !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, ingin %v", err, tt.err)
+			}
+			if q := fake.Query(); len(q) != 1 || !strings.HasSuffix(strings.TrimSpace(q[0]), "FOR UPDATE") {
+				t.Fatalf("ruang poli tidak dikunci: %q", q)
+			}
+		})
+	}
+}
+
+func TestPastikanPanggilanTerkini(t *testing.T) {
+	dipanggil := func(noRawat string) []hasilPalsu {
+		return []hasilPalsu{{
+			memuat: "status = '2'",
+			kolom:  []string{"no_rawat"},
+			baris:  [][]driver.Value{{noRawat}},
+		}}
+	}
+	harapan := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		hasil   []hasilPalsu
+		harapan *string
+		err     error
+	}{
+		{name: "tanpa harapan tidak diperiksa", hasil: dipanggil("2026/10/19/000001")},
+		{name: "pasien sama", hasil: dipanggil("2026/10/19/000001"), harapan: harapan("2026/10/19/000001")},
+		{name: "belum ada yang dipanggil", harapan: harapan("")},
+		{name: "pasien lain sudah dipanggil", hasil: dipanggil("2026/10/19/000002"), harapan: harapan("2026/10/19/000001"), err: errPanggilanBentrok},
+		{name: "panggilan sudah diakhiri", harapan: harapan("2026/10/19/000001"), err: errPanggilanBentrok},
+		{name: "client mengira kosong", hasil: dipanggil("2026/10/19/000001"), harapan: harapan(""), err: errPanggilanBentrok},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			if err := pastikanPanggilanTerkini(db, "R1", tt.harapan); !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, ingin %v", err, tt.err)
+			}
+			if tt.harapan == nil && len(fake.Query()) != 0 {
+				t.Fatalf("query dijalankan tanpa harapan: %q", fake.Query())
+			}
+		})
+	}
+}
+
+func TestCatatPanggilan(t *testing.T) {
+	const noRawat = "2026/10/19/000001"
+	logPasien := func(kdRuangPoli, status string) hasilPalsu {
+		return hasilPalsu{
+			memuat: "WHERE no_rawat = ? FOR UPDATE",
+			kolom:  []string{"no_rawat", "kd_ruang_poli", "status", "jumlah_panggil"},
+			baris:  [][]driver.Value{{noRawat, kdRuangPoli, status, int64(1)}},
+		}
+	}
+	// Pasien sebelumnya yang masih dipanggil di ruang poli yang sama
+	dipanggilSebelumnya := hasilPalsu{
+		memuat: "status = '2' AND no_rawat <> ?",
+		kolom:  []string{"no_rawat"},
+		baris:  [][]driver.Value{{"2026/10/19/000009"}},
+	}
+	kebijakan := func(kebijakan string) hasilPalsu {
+		return hasilPalsu{
+			memuat: "FROM `bw_pengaturan_ruang_poli`",
+			kolom:  []string{"kd_ruang_poli", "kebijakan_terlewat", "jumlah_sisip"},
+			baris:  [][]driver.Value{{"R1", kebijakan, int64(2)}},
+		}
+	}
+	// Hasil yang selalu dibutuhkan setelah status panggilan disimpan
+	dasar := func(jumlahPanggil int64) []hasilPalsu {
+		return []hasilPalsu{
+			{memuat: "SELECT jumlah_panggil FROM", kolom: []string{"jumlah_panggil"}, baris: [][]driver.Value{{jumlahPanggil}}},
+			{memuat: "FROM `bw_counter_antrian`", kolom: []string{"kd_ruang_poli", "tanggal", "terakhir"}, baris: [][]driver.Value{{"R1", time.Now(), int64(4)}}},
+			{memuat: "FROM `bw_nomor_antrian`", kolom: []string{"no_rawat", "kd_ruang_poli", "kode_antrian"}, baris: [][]driver.Value{{noRawat, "R1", "A-005"}}},
+		}
+	}
+	tests := []struct {
+		name          string
+		hasil         []hasilPalsu
+		err           error
+		jumlahPanggil int
+		kurangiLewati bool
+		terlewat      bool
+		dikembalikan  bool
+	}{
+		{
+			name:          "pasien baru",
+			hasil:         dasar(1),
+			jumlahPanggil: 1,
+			kurangiLewati: true,
+		},
+		{
+			name:          "pasien sebelumnya terlewat dengan kebijakan manual",
+			hasil:         append([]hasilPalsu{dipanggilSebelumnya}, dasar(1)...),
+			jumlahPanggil: 1,
+			kurangiLewati: true,
+			terlewat:      true,
+		},
+		{
+			name:          "pasien sebelumnya dikembalikan ke antrian",
+			hasil:         append([]hasilPalsu{dipanggilSebelumnya, kebijakan(models.KebijakanTerlewatSetelah)}, dasar(1)...),
+			jumlahPanggil: 1,
+			kurangiLewati: true,
+			terlewat:      true,
+			dikembalikan:  true,
+		},
+		{
+			name:          "panggil ulang tidak mengurangi jatah lewati",
+			hasil:         append([]hasilPalsu{logPasien("R1", "2")}, dasar(2)...),
+			jumlahPanggil: 2,
+		},
+		{
+			name:          "pasien terlewat dipanggil kembali",
+			hasil:         append([]hasilPalsu{logPasien("R1", "1")}, dasar(2)...),
+			jumlahPanggil: 2,
+			kurangiLewati: true,
+		},
+		{
+			name:  "pasien sedang dipanggil di ruang lain",
+			hasil: []hasilPalsu{logPasien("R2", "2")},
+			err:   errPanggilanBentrok,
+		},
+		{
+			name: "ruang poli dijeda",
+			hasil: []hasilPalsu{{
+				memuat: "FROM `bw_jeda_ruang_poli`",
+				kolom:  []string{"kd_ruang_poli", "alasan"},
+				baris:  [][]driver.Value{{"R1", "Istirahat"}},
+			}},
+			err: errRuangDijeda,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			msg := PanggilPoliMessage{KdRuangPoli: "R1", NoReg: "005", NmPasien: "Budi"}
+
+			err := catatPanggilan(db, &msg, noRawat)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, ingin %v", err, tt.err)
+			}
+
+			query := fake.Query()
+			for _, q := range query {
+				if strings.HasPrefix(strings.TrimSpace(q), "DELETE") {
+					t.Fatalf("log antrian dihapus: %s", q)
+				}
+			}
+			if tt.err != nil {
+				for _, q := range query {
+					if !strings.HasPrefix(strings.TrimSpace(q), "SELECT") {
+						t.Fatalf("data diubah meskipun panggilan ditolak: %s", q)
+					}
+				}
+				return
+			}
+
+			if msg.JumlahPanggil != tt.jumlahPanggil || msg.NoAntrian != "A-005" {
+				t.Fatalf("jumlah panggil %d nomor %q, ingin %d A-005", msg.JumlahPanggil, msg.NoAntrian, tt.jumlahPanggil)
+			}
+			if kurangi := cariQuery(query, "sisa_lewati = sisa_lewati - 1") >= 0; kurangi != tt.kurangiLewati {
+				t.Fatalf("jatah lewati dikurangi %v, ingin %v", kurangi, tt.kurangiLewati)
+			}
+
+			dipanggil := cariQuery(query, "ON DUPLICATE KEY UPDATE kd_ruang_poli = ?, status = '2'")
+			terlewat := cariQuery(query, "SET status = '1', batas_dipanggil = NULL")
+			dikembalikan := cariQuery(query, "VALUES (?, ?, '3'")
+			riwayat := cariQuery(query, "INSERT INTO `bw_riwayat_panggilan`")
+			if dipanggil < 0 || riwayat < 0 || dipanggil > riwayat {
+				t.Fatalf("query panggilan tidak lengkap: %q", query)
+			}
+			if (terlewat >= 0) != tt.terlewat || (dikembalikan >= 0) != tt.dikembalikan {
+				t.Fatalf("terlewat %v dikembalikan %v, ingin %v %v", terlewat >= 0, dikembalikan >= 0, tt.terlewat, tt.dikembalikan)
+			}
+			if tt.terlewat && !(dipanggil < terlewat && terlewat < riwayat) {
+				t.Fatalf("urutan query salah: dipanggil %d, terlewat %d, riwayat %d", dipanggil, terlewat, riwayat)
+			}
+			if tt.dikembalikan && dikembalikan < terlewat {
+				t.Fatalf("pasien dikembalikan sebelum ditandai terlewat")
+			}
+		})
+	}
+}
+
+func TestStatusErrorPanggilan(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{errPanggilanBentrok, http.StatusConflict},
+		{fmt.Errorf("%w: %s", errRuangDijeda, "Istirahat"), http.StatusConflict},
+		{errAntrianKosong, http.StatusNotFound},
+		{errRuangTidakDitemukan, http.StatusNotFound},
+		{errors.New("koneksi database terputus"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := statusErrorPanggilan(tt.err); got != tt.status {
+				t.Fatalf("status %d, ingin %d", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestSusunAntrian(t *testing.T) {
+	pasien := func(kode string) map[string]interface{} {
+		p := map[string]interface{}{"no_reg": kode, "jenis_prioritas": "", "didahulukan": int64(0)}
+		switch kode[0] {
+		case 'P':
+			p["jenis_prioritas"] = "LANSIA"
+		case 'D':
+			p["didahulukan"] = int64(1)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name            string
+		menunggu        string
+		selang          int
+		regulerTerakhir int
+		ingin           string
+	}{
+		{"tanpa prioritas", "R1 R2 R3", 2, 0, "R1 R2 R3"},
+		{"prioritas diselipkan setiap selang", "R1 R2 R3 R4 P1 P2", 2, 0, "R1 R2 P1 R3 R4 P2"},
+		{"selang sudah terpenuhi", "R1 R2 P1", 2, 2, "P1 R1 R2"},
+		{"selang nol tidak mendahulukan prioritas", "R1 P1 R2", 0, 5, "R1 P1 R2"},
+		{"prioritas tersisa di akhir", "R1 P1 P2 P3", 3, 0, "R1 P1 P2 P3"},
+		{"pasien didahulukan tetap di depan", "R1 P1 D1", 1, 1, "D1 P1 R1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var menunggu []map[string]interface{}
+			for _, kode := range strings.Fields(tt.menunggu) {
+				menunggu = append(menunggu, pasien(kode))
+			}
+
+			var urutan []string
+			for _, p := range susunAntrian(menunggu, tt.selang, tt.regulerTerakhir) {
+				urutan = append(urutan, p["no_reg"].(string))
+			}
+			if got := strings.Join(urutan, " "); got != tt.ingin {
+				t.Fatalf("urutan %q, ingin %q", got, tt.ingin)
+			}
+		})
+	}
+}
@@ -2,10 +2,18 @@ package handlers
 
 // PanggilPoliMessage mewakili struktur pesan untuk memanggil pasien
 type PanggilPoliMessage struct {
-	NmPasien    string `json:"nm_pasien"`
-	KdRuangPoli string `json:"kd_ruang_poli"`
-	NmPoli      string `json:"nm_poli"`
-	NoReg       string `json:"no_reg"`
-	KdDisplay   string `json:"kd_display"`
-	AudioUrl    string `json:"audio_url"` // URL file audio TTS
+	NmPasien       string `json:"nm_pasien"`
+	KdRuangPoli    string `json:"kd_ruang_poli"`
+	NmPoli         string `json:"nm_poli"`
+	NoReg          string `json:"no_reg"`
+	NoAntrian      string `json:"no_antrian"` // Nomor antrian rumah sakit, misalnya A-012
+	KdDisplay      string `json:"kd_display"`
+	AudioUrl       string `json:"audio_url"`       // URL file audio TTS
+	JumlahPanggil  int    `json:"jumlah_panggil"`  // Panggilan ke berapa untuk pasien ini
+	Prioritas      bool   `json:"prioritas"`       // Pasien termasuk jalur prioritas
+	JenisPrioritas string `json:"jenis_prioritas"` // Jenis prioritas untuk badge di display
+
+	// Hanya pada response ke konsol perawat
+	Ditahan        bool     `json:"ditahan"`                   // Tidak ada display yang menampilkan panggilan karena semuanya standby
+	DisplayDitahan []string `json:"display_ditahan,omitempty"` // Display standby yang tidak menerima panggilan
 }
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"time"
 
@@ -12,143 +15,219 @@ import (
 
 // DisplayPoliHandler menangani tampilan display poli
 type DisplayPoliHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Snapshot *DisplaySnapshotCache // Cache snapshot daftar poli per display
+	Socket   *DisplaySocketHub     // Koneksi WebSocket display yang menerima snapshot
 }
 
 // NewDisplayPoliHandler membuat instance baru dari DisplayPoliHandler
 func NewDisplayPoliHandler(db *gorm.DB) *DisplayPoliHandler {
-	return &DisplayPoliHandler{DB: db}
+	h := &DisplayPoliHandler{DB: db}
+	h.Snapshot = NewDisplaySnapshotCache(h.getPoliList)
+	h.Socket = NewDisplaySocketHub(h.Snapshot)
+	h.Socket.TambahPesanAwal(func(kdDisplay string) interface{} {
+		return pesanPanggilanTerakhir(h.DB, kdDisplay)
+	})
+	return h
 }
 
-// HandleDisplay menangani permintaan untuk menampilkan display poli
+// HandleDisplay menangani permintaan untuk menampilkan display poli.
+// Browser tidak dapat mengirim header Authorization saat membuka halaman, sehingga halaman ini tidak
+// memerlukan token dan tidak memuat data pasien. Halaman membaca token perangkat dari local storage
+// lalu mengambil daftar poli melalui API dan WebSocket display yang memeriksa token tersebut.
 func (h *DisplayPoliHandler) HandleDisplay(c *gin.Context) {
-	kdDisplay := c.Param("kd_display")
-	poliList := h.getPoliList(kdDisplay)
-
 	c.HTML(http.StatusOK, "displaypoli.html", gin.H{
-		"KdDisplay": kdDisplay,
-		"PoliList":  poliList,
+		"KdDisplay": c.Param("kd_display"),
 		"PusherKey": services.GetPusherKey(),
 		"AppURL":    services.GetAppURL(),
 	})
 }
 
-// GetPoliListByDisplay mendapatkan daftar poli untuk API
+// GetPoliListByDisplay mendapatkan daftar poli untuk API dari snapshot display.
+// Client yang mengirim If-None-Match dengan ETag snapshot terakhir mendapat 304 tanpa body.
+// Saat database bermasalah, data terakhir yang berhasil dikirim dengan basi=true,
+// atau 503 jika display belum pernah berhasil dimuat. Penyebab kegagalan hanya dicatat di log server.
 func (h *DisplayPoliHandler) GetPoliListByDisplay(c *gin.Context) {
 	kdDisplay := c.Param("kd_display")
-	poliList := h.getPoliList(kdDisplay)
-	c.JSON(http.StatusOK, poliList)
+	snapshot := h.Snapshot.Ambil(kdDisplay)
+	c.Header("Cache-Control", "no-cache")
+
+	if snapshot.Body == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"data":    nil,
+			"message": "Gagal memuat daftar poli, silakan coba lagi",
+			"basi":    true,
+		})
+		return
+	}
+
+	c.Header("ETag", snapshot.ETag)
+	if etagCocok(c.GetHeader("If-None-Match"), snapshot.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	message := ""
+	if snapshot.Basi {
+		message = "Gagal memuat data terbaru, menampilkan data pukul " + snapshot.Dibuat.Format("15:04:05")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    json.RawMessage(snapshot.Body),
+		"message": message,
+		"basi":    snapshot.Basi,
+		"dibuat":  snapshot.Dibuat,
+	})
 }
 
-// getPoliList mendapatkan daftar poli berdasarkan kode display
-func (h *DisplayPoliHandler) getPoliList(kdDisplay string) []map[string]interface{} {
-	var results []map[string]interface{}
+// getPoliList mendapatkan daftar poli berdasarkan kode display.
+// Pasien seluruh ruang poli diambil dengan sejumlah query tetap lalu dikelompokkan per ruang poli,
+// sehingga jumlah query tidak bertambah seiring jumlah ruang poli pada display. Fungsi ini hanya membaca;
+// nomor antrian diberikan oleh MulaiPenomoranAntrian dan saat pasien dipanggil.
+// Error query dikembalikan agar snapshot terakhir yang berhasil tidak ditimpa data kosong.
+func (h *DisplayPoliHandler) getPoliList(kdDisplay string) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
 
-	h.DB.Table("bw_ruang_poli").
-		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, bw_ruang_poli.kd_display, bw_ruang_poli.posisi_display_poli").
-		Where("bw_ruang_poli.kd_display = ?", kdDisplay).
-		Order("bw_ruang_poli.posisi_display_poli asc").
-		Find(&results)
+	err := h.DB.Table("bw_ruang_poli").
+		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, bw_display_ruang_poli.kd_display, bw_display_ruang_poli.posisi AS posisi_display_poli").
+		Joins("JOIN bw_display_ruang_poli ON bw_ruang_poli.kd_ruang_poli = bw_display_ruang_poli.kd_ruang_poli").
+		Where("bw_display_ruang_poli.kd_display = ?", kdDisplay).
+		Order("bw_display_ruang_poli.posisi asc").
+		Order("bw_ruang_poli.kd_ruang_poli asc").
+		Find(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("ruang poli: %w", err)
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
 
-	// Mengambil pasien untuk setiap poli
+	kdRuangPoliList := make([]string, len(results))
 	for i := range results {
-		hari := services.GetDayList()[time.Now().Format("Monday")]
-		var pasienList []map[string]interface{}
-		var missedPatients []map[string]interface{}
-
-		// Pertama cek apakah ada pasien yang sedang dipanggil (status=2)
-		h.DB.Table("reg_periksa").
-			Select("reg_periksa.no_reg, reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, jadwal.hari_kerja, jadwal.jam_mulai, bw_ruangpoli_dokter.kd_ruang_poli, pasien.nm_pasien, reg_periksa.kd_pj").
-			Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
-			Joins("JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
-			Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
-			Joins("JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
-			Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
-			Where("jadwal.hari_kerja = ?", hari).
-			Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", results[i]["kd_ruang_poli"]).
-			Where("bw_log_antrian_poli.status = '2'"). // Status 2 = sedang dipanggil
-			Order("jadwal.jam_mulai asc").
-			Order("reg_periksa.no_reg asc").
-			Order("reg_periksa.jam_reg asc").
-			Limit(1).
-			Find(&pasienList)
-
-		// Jika tidak ada pasien yang sedang dipanggil, ambil pasien berikutnya seperti biasa
-		if len(pasienList) == 0 {
-			h.DB.Table("reg_periksa").
-				Select("reg_periksa.no_reg, reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, jadwal.hari_kerja, jadwal.jam_mulai, bw_ruangpoli_dokter.kd_ruang_poli, pasien.nm_pasien, reg_periksa.kd_pj").
-				Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
-				Joins("JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
-				Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
-				Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
-				Where("jadwal.hari_kerja = ?", hari).
-				Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", results[i]["kd_ruang_poli"]).
-				Where("NOT EXISTS (SELECT 1 FROM bw_log_antrian_poli WHERE reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat)").
-				Order("jadwal.jam_mulai asc").
-				Order("reg_periksa.no_reg asc").
-				Order("reg_periksa.jam_reg asc").
-				Limit(1).
-				Find(&pasienList)
+		kdRuangPoliList[i] = fmt.Sprint(results[i]["kd_ruang_poli"])
+	}
+
+	// Ambil pasien yang sedang dipanggil (status=2), menunggu (tanpa log atau status=3),
+	// dan terlewat (status=1) untuk semua ruang poli sekaligus
+	kolomJenis, args := kolomPrioritas(h.DB)
+	var pasienList []map[string]interface{}
+	err = urutkanAntrian(queryAntrianRuang(h.DB, kdRuangPoliList).
+		Select("reg_periksa.no_reg, "+kolomNomorAntrian+", reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, jadwal.hari_kerja, jadwal.jam_mulai, "+kolomRuangPoli+", pasien.nm_pasien, reg_periksa.kd_pj, bw_log_antrian_poli.status, bw_log_antrian_poli.jumlah_panggil, "+kolomJenis+", "+kolomDidahulukan, args...).
+		Joins("LEFT JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
+		Where("(bw_log_antrian_poli.no_rawat IS NULL OR bw_log_antrian_poli.status IN ('1', '2', '3'))").
+		Order(urutanMenunggu)).
+		Find(&pasienList).Error
+	if err != nil {
+		return nil, fmt.Errorf("pasien: %w", err)
+	}
+
+	pengaturan, err := getPengaturanRuangPoliList(h.DB, kdRuangPoliList)
+	if err != nil {
+		return nil, fmt.Errorf("pengaturan ruang poli: %w", err)
+	}
+	regulerTerakhir, err := regulerSejakPrioritasRuang(h.DB, kdRuangPoliList)
+	if err != nil {
+		return nil, fmt.Errorf("panggilan reguler: %w", err)
+	}
+	jeda, err := jedaRuangPoliList(h.DB, kdRuangPoliList)
+	if err != nil {
+		return nil, fmt.Errorf("status jeda: %w", err)
+	}
+	estimasi, err := estimasiRuangPoli(h.DB, kdRuangPoliList)
+	if err != nil {
+		return nil, fmt.Errorf("estimasi waktu tunggu: %w", err)
+	}
+	jadwalDokter, err := jadwalDokterRuangPoli(h.DB, kdRuangPoliList)
+	if err != nil {
+		return nil, fmt.Errorf("status dokter: %w", err)
+	}
+	sekarang := time.Now()
+
+	// Nama pasien disamarkan sesuai kebijakan display dan ruang poli yang lebih ketat
+	samaran, err := samaranDisplay(h.DB, []string{kdDisplay})
+	if err != nil {
+		return nil, fmt.Errorf("samaran nama: %w", err)
+	}
+	samaranNamaDisplay := samaran[kdDisplay]
+
+	// Kelompokkan pasien per ruang poli dengan urutan query tetap dipertahankan
+	dipanggil := make(map[string][]map[string]interface{})
+	menunggu := make(map[string][]map[string]interface{})
+	terlewat := make(map[string][]map[string]interface{})
+	for _, pasien := range pasienList {
+		kdRuangPoli := fmt.Sprint(pasien["kd_ruang_poli"])
+		switch stringValue(pasien["status"]) {
+		case "2": // Sedang dipanggil
+			dipanggil[kdRuangPoli] = append(dipanggil[kdRuangPoli], pasien)
+		case "1": // Terlewat
+			terlewat[kdRuangPoli] = append(terlewat[kdRuangPoli], pasien)
+		default: // Menunggu
+			menunggu[kdRuangPoli] = append(menunggu[kdRuangPoli], pasien)
 		}
+	}
 
-		// Ambil daftar pasien yang terlewat (status=1)
-		h.DB.Table("reg_periksa").
-			Select("reg_periksa.no_reg, reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, "+
-				"jadwal.hari_kerja, jadwal.jam_mulai, bw_ruangpoli_dokter.kd_ruang_poli, "+
-				"pasien.nm_pasien, reg_periksa.kd_pj, bw_log_antrian_poli.status").
-			Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
-			Joins("JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
-			Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
-			Joins("JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
-			Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
-			Where("jadwal.hari_kerja = ?", hari).
-			Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", results[i]["kd_ruang_poli"]).
-			Where("bw_log_antrian_poli.status = '1'"). // Status 1 = terlewat
-			Order("jadwal.jam_mulai asc").
-			Order("reg_periksa.no_reg asc").
-			Order("reg_periksa.jam_reg asc").
-			Find(&missedPatients)
-
-		if len(pasienList) > 0 {
-			results[i]["getPasien"] = pasienList
-		} else {
-			results[i]["getPasien"] = []map[string]interface{}{}
+	for i, kdRuangPoli := range kdRuangPoliList {
+		// Ruang poli yang dijeda menampilkan alasan jeda, bukan pasien berikutnya
+		results[i]["jeda"] = jeda[kdRuangPoli]
+
+		// Dokter yang bertugas beserta jadwal, status kehadiran, dan keterlambatannya
+		results[i]["dokter"] = dokterAktif(jadwalDokter[kdRuangPoli], sekarang)
+
+		// Urutkan pasien menunggu sesuai giliran panggil dan tambahkan estimasi waktu tunggu
+		urutan := susunAntrian(menunggu[kdRuangPoli], pengaturan[kdRuangPoli].SelangPrioritas, regulerTerakhir[kdRuangPoli])
+		var kembali *time.Time
+		if jeda[kdRuangPoli] != nil {
+			kembali = jeda[kdRuangPoli].PerkiraanKembali
 		}
+		tandaiEstimasi(urutan, estimasi[kdRuangPoli], kembali)
+
+		// Display hanya menampilkan nomor antrian dan estimasi untuk daftar tunggu
+		antrianMenunggu := make([]map[string]interface{}, len(urutan))
+		for j, pasien := range urutan {
+			antrianMenunggu[j] = map[string]interface{}{
+				"no_antrian":        pasien["no_antrian"],
+				"posisi_antrian":    pasien["posisi_antrian"],
+				"perkiraan_panggil": pasien["perkiraan_panggil"],
+				"perkiraan_menit":   pasien["perkiraan_menit"],
+			}
+		}
+		results[i]["antrianMenunggu"] = antrianMenunggu
+		results[i]["estimasi"] = map[string]interface{}{
+			"jumlah_menunggu": len(urutan),
+			"selang_menit":    int(math.Round(estimasi[kdRuangPoli].selang.Minutes())),
+		}
+
+		samaranNama := samaranLebihKetat(samaranNamaDisplay, pengaturan[kdRuangPoli].SamaranNama)
+		results[i]["samaran_nama"] = samaranNama
+
+		// Tampilkan pasien yang sedang dipanggil, atau pasien berikutnya jika tidak ada
+		getPasien := []map[string]interface{}{}
+		if len(dipanggil[kdRuangPoli]) > 0 {
+			getPasien = dipanggil[kdRuangPoli][:1]
+		} else if jeda[kdRuangPoli] == nil && len(urutan) > 0 {
+			getPasien = urutan[:1]
+		}
+		samarkanPasien(getPasien, samaranNama)
+		results[i]["getPasien"] = getPasien
 
 		// Tambahkan daftar pasien yang terlewat
-		if len(missedPatients) > 0 {
-			results[i]["missedPatients"] = missedPatients
+		if len(terlewat[kdRuangPoli]) > 0 {
+			samarkanPasien(terlewat[kdRuangPoli], samaranNama)
+			results[i]["missedPatients"] = terlewat[kdRuangPoli]
 		} else {
 			results[i]["missedPatients"] = []map[string]interface{}{}
 		}
 	}
 
-	return results
+	return results, nil
 }
 
 // GetMissedPatients mendapatkan daftar pasien yang terlewat untuk poli tertentu
 func (h *DisplayPoliHandler) GetMissedPatients(c *gin.Context) {
 	kdRuangPoli := c.Param("kd_ruang_poli")
-	hari := services.GetDayList()[time.Now().Format("Monday")]
-
-	var missedPatients []map[string]interface{}
-
-	h.DB.Table("reg_periksa").
-		Select("reg_periksa.no_reg, reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, "+
-			"jadwal.hari_kerja, jadwal.jam_mulai, bw_ruangpoli_dokter.kd_ruang_poli, "+
-			"pasien.nm_pasien, reg_periksa.kd_pj, bw_log_antrian_poli.status").
-		Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
-		Joins("JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
-		Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
-		Joins("JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
-		Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
-		Where("jadwal.hari_kerja = ?", hari).
-		Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", kdRuangPoli).
-		Where("bw_log_antrian_poli.status = '1'"). // Status 1 = terlewat
-		Order("jadwal.jam_mulai asc").
-		Order("reg_periksa.no_reg asc").
-		Order("reg_periksa.jam_reg asc").
-		Find(&missedPatients)
+	missedPatients := queryTerlewat(h.DB, kdRuangPoli)
 
 	if len(missedPatients) > 0 {
 		c.JSON(http.StatusOK, gin.H{
@@ -166,3 +245,18 @@ func (h *DisplayPoliHandler) GetMissedPatients(c *gin.Context) {
 		})
 	}
 }
+
+// queryTerlewat mendapatkan daftar pasien yang terlewat (status=1) pada ruang poli tertentu
+func queryTerlewat(db *gorm.DB, kdRuangPoli string) []map[string]interface{} {
+	var missedPatients []map[string]interface{}
+
+	urutkanAntrian(queryAntrian(db, kdRuangPoli)).
+		Select("reg_periksa.no_reg, " + kolomNomorAntrian + ", reg_periksa.no_rawat, bw_ruangpoli_dokter.nama_dokter, " +
+			"jadwal.hari_kerja, jadwal.jam_mulai, " + kolomRuangPoli + ", " +
+			"pasien.nm_pasien, reg_periksa.kd_pj, bw_log_antrian_poli.status, bw_log_antrian_poli.jumlah_panggil").
+		Joins("JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
+		Where("bw_log_antrian_poli.status = '1'"). // Status 1 = terlewat
+		Find(&missedPatients)
+
+	return missedPatients
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// hasilDisplayPalsu menyiapkan display dengan sejumlah ruang poli yang masing-masing memiliki
+// satu pasien sedang dipanggil, satu menunggu, dan satu terlewat
+func hasilDisplayPalsu(jumlahRuang int) []hasilPalsu {
+	ruang := hasilPalsu{
+		memuat: "posisi_display_poli",
+		kolom:  []string{"kd_ruang_poli", "nama_ruang_poli", "kd_display", "posisi_display_poli"},
+	}
+	pasien := hasilPalsu{
+		memuat: "bw_log_antrian_poli.jumlah_panggil",
+		kolom:  []string{"no_rawat", "no_antrian", "nm_pasien", "kd_ruang_poli", "status"},
+	}
+	for i := 1; i <= jumlahRuang; i++ {
+		kd := fmt.Sprintf("R%02d", i)
+		ruang.baris = append(ruang.baris, []driver.Value{kd, "Ruang " + kd, "D1", int64(i)})
+		for j, status := range []driver.Value{"2", nil, "1"} {
+			noRawat := fmt.Sprintf("2026/10/19/%s%d", kd, j)
+			pasien.baris = append(pasien.baris, []driver.Value{noRawat, fmt.Sprintf("%s-%03d", kd, j+1), "Pasien " + noRawat, kd, status})
+		}
+	}
+	return []hasilPalsu{ruang, pasien}
+}
+
+func TestGetPoliListJumlahQueryTetap(t *testing.T) {
+	var pembanding int
+	for _, jumlahRuang := range []int{1, 3, 10} {
+		t.Run(fmt.Sprintf("%d ruang poli", jumlahRuang), func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, hasilDisplayPalsu(jumlahRuang)...)
+			h := &DisplayPoliHandler{DB: db}
+
+			results, err := h.getPoliList("D1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != jumlahRuang {
+				t.Fatalf("ruang poli %d, ingin %d", len(results), jumlahRuang)
+			}
+			for _, r := range results {
+				if pasien, _ := r["getPasien"].([]map[string]interface{}); len(pasien) != 1 || pasien[0]["status"] != "2" {
+					t.Fatalf("ruang poli %v: pasien dipanggil %v", r["kd_ruang_poli"], r["getPasien"])
+				}
+				if menunggu, _ := r["antrianMenunggu"].([]map[string]interface{}); len(menunggu) != 1 {
+					t.Fatalf("ruang poli %v: antrian menunggu %v", r["kd_ruang_poli"], r["antrianMenunggu"])
+				}
+				if terlewat, _ := r["missedPatients"].([]map[string]interface{}); len(terlewat) != 1 {
+					t.Fatalf("ruang poli %v: pasien terlewat %v", r["kd_ruang_poli"], r["missedPatients"])
+				}
+			}
+
+			query := fake.Query()
+			for _, q := range query {
+				kata := strings.ToUpper(strings.Fields(strings.TrimSpace(q))[0])
+				if kata != "SELECT" {
+					t.Fatalf("getPoliList menulis ke database: %s", q)
+				}
+			}
+			if pembanding == 0 {
+				pembanding = len(query)
+			} else if len(query) != pembanding {
+				t.Fatalf("jumlah query %d, ingin tetap %d", len(query), pembanding)
+			}
+		})
+	}
+}
+
+func BenchmarkGetPoliList(b *testing.B) {
+	for _, jumlahRuang := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("%d ruang poli", jumlahRuang), func(b *testing.B) {
+			db, fake := bukaDatabasePalsu(b, hasilDisplayPalsu(jumlahRuang)...)
+			h := &DisplayPoliHandler{DB: db}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := h.getPoliList("D1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(fake.Query()))/float64(b.N), "query/op")
+		})
+	}
+}
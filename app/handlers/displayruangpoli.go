@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// buatDisplayRuangPoli menyusun pemetaan display ruang poli dari input kd_display dan posisi_display_poli
+// yang dikirim berpasangan. Display yang sama tidak boleh dipilih dua kali.
+func buatDisplayRuangPoli(kdRuangPoli string, kdDisplay []string, posisi []int) ([]models.DisplayRuangPoli, error) {
+	if len(kdDisplay) == 0 {
+		return nil, errors.New("minimal satu display harus dipilih")
+	}
+	if len(posisi) != len(kdDisplay) {
+		return nil, errors.New("posisi harus diisi untuk setiap display")
+	}
+
+	ada := make(map[string]bool, len(kdDisplay))
+	mapping := make([]models.DisplayRuangPoli, 0, len(kdDisplay))
+	for i, kd := range kdDisplay {
+		if kd == "" {
+			return nil, errors.New("kode display tidak boleh kosong")
+		}
+		if ada[kd] {
+			return nil, errors.New("display " + kd + " dipilih lebih dari sekali")
+		}
+		ada[kd] = true
+
+		mapping = append(mapping, models.DisplayRuangPoli{
+			KdDisplay:   kd,
+			KdRuangPoli: kdRuangPoli,
+			Posisi:      posisi[i],
+		})
+	}
+	return mapping, nil
+}
+
+// simpanDisplayRuangPoli mengganti seluruh pemetaan display sebuah ruang poli. Dipanggil di dalam transaksi.
+func simpanDisplayRuangPoli(tx *gorm.DB, kdRuangPoli string, mapping []models.DisplayRuangPoli) error {
+	if err := tx.Where("kd_ruang_poli = ?", kdRuangPoli).Delete(&models.DisplayRuangPoli{}).Error; err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+	return tx.Create(&mapping).Error
+}
+
+// displayRuangPoliList mengambil display setiap ruang poli beserta nama dan posisinya, diurutkan per kode display
+func displayRuangPoliList(db *gorm.DB, kdRuangPoliList []string) map[string][]map[string]interface{} {
+	hasil := make(map[string][]map[string]interface{}, len(kdRuangPoliList))
+	if len(kdRuangPoliList) == 0 {
+		return hasil
+	}
+
+	var rows []map[string]interface{}
+	db.Table("bw_display_ruang_poli").
+		Select("bw_display_ruang_poli.kd_ruang_poli, bw_display_ruang_poli.kd_display, bw_display_poli.nama_display, bw_display_ruang_poli.posisi AS posisi_display_poli").
+		Joins("JOIN bw_display_poli ON bw_display_ruang_poli.kd_display = bw_display_poli.kd_display").
+		Where("bw_display_ruang_poli.kd_ruang_poli IN ?", kdRuangPoliList).
+		Order("bw_display_ruang_poli.kd_display asc").
+		Find(&rows)
+
+	for _, row := range rows {
+		kd := stringValue(row["kd_ruang_poli"])
+		delete(row, "kd_ruang_poli")
+		hasil[kd] = append(hasil[kd], row)
+	}
+	return hasil
+}
+
+// displayUntukRuangPoli mengembalikan kode semua display yang menampilkan ruang poli
+func displayUntukRuangPoli(db *gorm.DB, kdRuangPoli string) ([]string, error) {
+	var kdDisplay []string
+	err := db.Model(&models.DisplayRuangPoli{}).
+		Where("kd_ruang_poli = ?", kdRuangPoli).
+		Order("kd_display asc").
+		Pluck("kd_display", &kdDisplay).Error
+	return kdDisplay, err
+}
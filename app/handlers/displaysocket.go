@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ukuranAntrianKirim adalah jumlah pesan yang boleh menunggu dikirim ke satu display.
+// Display yang tertinggal lebih dari ini dianggap macet dan koneksinya ditutup.
+const ukuranAntrianKirim = 32
+
+// DisplaySocketHub mengelola koneksi WebSocket display. Pesan panggilan dikirim ke display yang menampilkan
+// ruang poli, sedangkan snapshot daftar poli dikirim ke display yang bersangkutan setiap kali berubah.
+type DisplaySocketHub struct {
+	mu       sync.Mutex
+	snapshot *DisplaySnapshotCache
+	clients  map[*websocket.Conn]*displayClient
+	tertunda map[string]bool // Display yang snapshot-nya perlu dikirim ulang
+	sinyal   chan struct{}
+	awal     []func(kdDisplay string) interface{}
+}
+
+// displayClient adalah satu koneksi display. Semua penulisan ke koneksi dilakukan oleh goroutine tulis.
+type displayClient struct {
+	conn        *websocket.Conn
+	kdDisplay   string
+	idPerangkat uint // Perangkat pemilik koneksi, 0 jika token tidak diwajibkan
+	kirim       chan interface{}
+	etag        string // ETag snapshot terakhir yang dikirim ke display ini
+}
+
+// pesanSnapshot adalah pesan WebSocket berisi snapshot lengkap daftar poli sebuah display.
+// Basi menandakan data terakhir yang berhasil dimuat karena pembangunan terbaru gagal.
+type pesanSnapshot struct {
+	Type      string          `json:"type"`
+	KdDisplay string          `json:"kd_display"`
+	ETag      string          `json:"etag"`
+	Data      json.RawMessage `json:"data"`
+	Basi      bool            `json:"basi"`
+	Dibuat    time.Time       `json:"dibuat"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// pesanDisplay adalah pesan WebSocket umum untuk sebuah display, misalnya pengaturan layout
+type pesanDisplay struct {
+	Type      string      `json:"type"`
+	KdDisplay string      `json:"kd_display"`
+	Data      interface{} `json:"data"`
+}
+
+// NewDisplaySocketHub membuat instance baru dari DisplaySocketHub yang mengirim snapshot dari cache
+func NewDisplaySocketHub(snapshot *DisplaySnapshotCache) *DisplaySocketHub {
+	h := &DisplaySocketHub{
+		snapshot: snapshot,
+		clients:  make(map[*websocket.Conn]*displayClient),
+		tertunda: make(map[string]bool),
+		sinyal:   make(chan struct{}, 1),
+	}
+	snapshot.SaatBerubah(h.tandaiDisplay)
+	return h
+}
+
+// Jalankan mengirim snapshot ke display yang ditandai berubah. Dijalankan sebagai goroutine.
+func (h *DisplaySocketHub) Jalankan() {
+	for range h.sinyal {
+		h.mu.Lock()
+		tertunda := h.tertunda
+		h.tertunda = make(map[string]bool)
+		h.mu.Unlock()
+
+		for kdDisplay := range tertunda {
+			h.kirimSnapshot(kdDisplay)
+		}
+	}
+}
+
+// TambahPesanAwal menambahkan fungsi pembuat pesan yang dikirim ke display saat baru terhubung.
+// Fungsi yang mengembalikan nil tidak mengirim pesan. Dipanggil sebelum server mulai menerima koneksi.
+func (h *DisplaySocketHub) TambahPesanAwal(fn func(kdDisplay string) interface{}) {
+	h.mu.Lock()
+	h.awal = append(h.awal, fn)
+	h.mu.Unlock()
+}
+
+// Daftarkan mendaftarkan koneksi display milik perangkat, mengirim pesan awal, dan menjadwalkan
+// pengiriman snapshot awal
+func (h *DisplaySocketHub) Daftarkan(conn *websocket.Conn, kdDisplay string, idPerangkat uint) {
+	client := &displayClient{
+		conn:        conn,
+		kdDisplay:   kdDisplay,
+		idPerangkat: idPerangkat,
+		kirim:       make(chan interface{}, ukuranAntrianKirim),
+	}
+
+	h.mu.Lock()
+	awal := h.awal
+	h.mu.Unlock()
+
+	var pesanAwal []interface{}
+	for _, fn := range awal {
+		if pesan := fn(kdDisplay); pesan != nil {
+			pesanAwal = append(pesanAwal, pesan)
+		}
+	}
+
+	h.mu.Lock()
+	h.clients[conn] = client
+	for _, pesan := range pesanAwal {
+		h.antrekan(client, pesan)
+	}
+	h.mu.Unlock()
+
+	go client.tulis()
+	h.tandaiDisplay([]string{kdDisplay})
+}
+
+// Lepaskan menghapus koneksi display yang sudah ditutup
+func (h *DisplaySocketHub) Lepaskan(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if client, ok := h.clients[conn]; ok {
+		delete(h.clients, conn)
+		close(client.kirim)
+	}
+}
+
+// PutuskanPerangkat menutup semua koneksi milik perangkat, dipakai saat perangkat dicabut
+func (h *DisplaySocketHub) PutuskanPerangkat(idPerangkat uint) {
+	if h == nil || idPerangkat == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn, client := range h.clients {
+		if client.idPerangkat == idPerangkat {
+			delete(h.clients, conn)
+			close(client.kirim)
+		}
+	}
+}
+
+// KirimKeDisplay mengirim pesan ke semua koneksi display tertentu
+func (h *DisplaySocketHub) KirimKeDisplay(kdDisplay string, pesan interface{}) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		if client.kdDisplay == kdDisplay {
+			h.antrekan(client, pesan)
+		}
+	}
+}
+
+// DisplayTerhubung mengembalikan kode display yang sedang memiliki koneksi
+func (h *DisplaySocketHub) DisplayTerhubung() []string {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ada := make(map[string]bool)
+	var hasil []string
+	for _, client := range h.clients {
+		if !ada[client.kdDisplay] {
+			ada[client.kdDisplay] = true
+			hasil = append(hasil, client.kdDisplay)
+		}
+	}
+	return hasil
+}
+
+// tandaiDisplay menjadwalkan pengiriman snapshot untuk display yang memiliki koneksi
+func (h *DisplaySocketHub) tandaiDisplay(kdDisplay []string) {
+	h.mu.Lock()
+	for _, kd := range kdDisplay {
+		for _, client := range h.clients {
+			if client.kdDisplay == kd {
+				h.tertunda[kd] = true
+				break
+			}
+		}
+	}
+	adaTertunda := len(h.tertunda) > 0
+	h.mu.Unlock()
+
+	if adaTertunda {
+		select {
+		case h.sinyal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// kirimSnapshot mengirim snapshot terbaru ke koneksi display yang belum menerimanya.
+// Display yang belum pernah berhasil dimuat tidak dikirimi apa pun agar layar tidak dikosongkan.
+func (h *DisplaySocketHub) kirimSnapshot(kdDisplay string) {
+	snapshot := h.snapshot.Ambil(kdDisplay)
+	if snapshot.Body == nil {
+		return
+	}
+
+	pesan := pesanSnapshot{
+		Type:      "snapshot",
+		KdDisplay: kdDisplay,
+		ETag:      snapshot.ETag,
+		Data:      snapshot.Body,
+		Basi:      snapshot.Basi,
+		Dibuat:    snapshot.Dibuat,
+	}
+	if snapshot.Basi {
+		pesan.Message = "Gagal memuat data terbaru, menampilkan data pukul " + snapshot.Dibuat.Format("15:04:05")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		if client.kdDisplay == kdDisplay && client.etag != snapshot.ETag {
+			client.etag = snapshot.ETag
+			h.antrekan(client, pesan)
+		}
+	}
+}
+
+// antrekan menaruh pesan pada antrian kirim display. Harus dipanggil saat mu terkunci.
+func (h *DisplaySocketHub) antrekan(client *displayClient, pesan interface{}) {
+	select {
+	case client.kirim <- pesan:
+	default:
+		log.Printf("Antrian kirim display %s penuh, menutup koneksi %s", client.kdDisplay, client.conn.RemoteAddr())
+		delete(h.clients, client.conn)
+		close(client.kirim)
+	}
+}
+
+// tulis mengirim pesan dari antrian ke koneksi display sampai antrian ditutup
+func (k *displayClient) tulis() {
+	defer k.conn.Close()
+
+	for pesan := range k.kirim {
+		if err := k.conn.WriteJSON(pesan); err != nil {
+			log.Printf("Error broadcasting message: %v", err)
+			return
+		}
+	}
+}
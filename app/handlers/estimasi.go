@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// jumlahSelangEstimasi adalah jumlah selang panggilan terakhir yang dipakai untuk estimasi waktu tunggu
+const jumlahSelangEstimasi = 10
+
+// estimasiRuang menyimpan dasar perkiraan waktu panggil pasien pada satu ruang poli
+type estimasiRuang struct {
+	selang          time.Duration // Selang waktu antar panggilan pasien baru
+	panggilTerakhir time.Time     // Panggilan pasien baru terakhir hari ini, kosong jika belum ada
+}
+
+// estimasiRuangPoli menghitung dasar estimasi beberapa ruang poli dari riwayat panggilan hari ini.
+// Selang adalah median dari selang panggilan pasien baru terakhir sehingga jeda panjang
+// (misalnya dokter istirahat) tidak terlalu memengaruhi estimasi. Ruang poli tanpa riwayat
+// memakai RATA_PELAYANAN.
+func estimasiRuangPoli(db *gorm.DB, kdRuangPoliList []string) (map[string]estimasiRuang, error) {
+	hasil := make(map[string]estimasiRuang, len(kdRuangPoliList))
+	bawaan := time.Duration(services.GetRataPelayanan()) * time.Minute
+	for _, kd := range kdRuangPoliList {
+		hasil[kd] = estimasiRuang{selang: bawaan}
+	}
+	if len(kdRuangPoliList) == 0 {
+		return hasil, nil
+	}
+
+	var riwayat []models.RiwayatPanggilan
+	err := db.Select("kd_ruang_poli, waktu_panggil").
+		Where("kd_ruang_poli IN ? AND panggilan_ke = 1 AND waktu_panggil >= ?", kdRuangPoliList, awalHariIni()).
+		Order("kd_ruang_poli asc").
+		Order("waktu_panggil asc").
+		Find(&riwayat).Error
+	if err != nil {
+		return hasil, err
+	}
+
+	waktuPanggil := make(map[string][]time.Time)
+	for _, r := range riwayat {
+		waktuPanggil[r.KdRuangPoli] = append(waktuPanggil[r.KdRuangPoli], r.WaktuPanggil)
+	}
+
+	for kd, waktu := range waktuPanggil {
+		estimasi := hasil[kd]
+		estimasi.panggilTerakhir = waktu[len(waktu)-1]
+
+		var selang []time.Duration
+		for i := len(waktu) - 1; i > 0 && len(selang) < jumlahSelangEstimasi; i-- {
+			selang = append(selang, waktu[i].Sub(waktu[i-1]))
+		}
+		if len(selang) > 0 {
+			sort.Slice(selang, func(a, b int) bool { return selang[a] < selang[b] })
+			estimasi.selang = selang[len(selang)/2]
+		}
+
+		hasil[kd] = estimasi
+	}
+
+	return hasil, nil
+}
+
+// perkiraan menghitung perkiraan waktu panggil pasien pada posisi antrian tertentu (mulai dari 1).
+// Panggilan tidak diperkirakan sebelum tidakSebelum, misalnya jam mulai praktek dokter.
+func (e estimasiRuang) perkiraan(posisi int, tidakSebelum, sekarang time.Time) time.Time {
+	mulai := sekarang
+	if !e.panggilTerakhir.IsZero() && e.panggilTerakhir.Add(e.selang).After(mulai) {
+		mulai = e.panggilTerakhir.Add(e.selang)
+	}
+	if tidakSebelum.After(mulai) {
+		mulai = tidakSebelum
+	}
+	return mulai.Add(time.Duration(posisi-1) * e.selang)
+}
+
+// tandaiEstimasi menambahkan posisi_antrian, perkiraan_panggil (HH:MM), dan perkiraan_menit pada
+// pasien menunggu yang sudah diurutkan sesuai giliran panggil. Query pasien harus memuat jadwal.jam_mulai.
+// kembali adalah perkiraan kembali jika ruang poli sedang dijeda.
+func tandaiEstimasi(menunggu []map[string]interface{}, estimasi estimasiRuang, kembali *time.Time) {
+	sekarang := time.Now()
+	for i, pasien := range menunggu {
+		tidakSebelum := jamHariIni(pasien["jam_mulai"])
+		if kembali != nil && kembali.After(tidakSebelum) {
+			tidakSebelum = *kembali
+		}
+
+		perkiraan := estimasi.perkiraan(i+1, tidakSebelum, sekarang)
+		pasien["posisi_antrian"] = i + 1
+		pasien["perkiraan_panggil"] = perkiraan.Format("15:04")
+		pasien["perkiraan_menit"] = int(math.Ceil(perkiraan.Sub(sekarang).Minutes()))
+	}
+}
+
+// jamHariIni mengubah nilai kolom jam (HH:MM:SS) menjadi waktu hari ini, kosong jika tidak valid
+func jamHariIni(value interface{}) time.Time {
+	jam := stringValue(value)
+	t, err := time.ParseInLocation("15:04:05", jam, time.Local)
+	if err != nil {
+		if t, err = time.ParseInLocation("15:04", jam, time.Local); err != nil {
+			return time.Time{}
+		}
+	}
+
+	hariIni := awalHariIni()
+	return time.Date(hariIni.Year(), hariIni.Month(), hariIni.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+}
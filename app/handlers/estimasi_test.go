@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestEstimasiRuangPoli(t *testing.T) {
+	pagi := awalHariIni().Add(8 * time.Hour)
+	// panggilan membuat riwayat panggilan pertama pada menit-menit tertentu setelah pukul 08:00
+	panggilan := func(kdRuangPoli string, menit ...int) [][]driver.Value {
+		var baris [][]driver.Value
+		for _, m := range menit {
+			baris = append(baris, []driver.Value{kdRuangPoli, pagi.Add(time.Duration(m) * time.Minute)})
+		}
+		return baris
+	}
+
+	tests := []struct {
+		name      string
+		riwayat   [][]driver.Value
+		selang    time.Duration
+		terakhir  time.Time
+		ruangLain time.Duration
+	}{
+		{
+			name:   "tanpa riwayat memakai RATA_PELAYANAN",
+			selang: 7 * time.Minute,
+		},
+		{
+			name:     "satu panggilan memakai RATA_PELAYANAN",
+			riwayat:  panggilan("R1", 0),
+			selang:   7 * time.Minute,
+			terakhir: pagi,
+		},
+		{
+			name:     "median selang",
+			riwayat:  panggilan("R1", 0, 4, 9, 15),
+			selang:   5 * time.Minute,
+			terakhir: pagi.Add(15 * time.Minute),
+		},
+		{
+			name:     "jeda istirahat tidak menggeser estimasi",
+			riwayat:  panggilan("R1", 0, 5, 10, 75, 80),
+			selang:   5 * time.Minute,
+			terakhir: pagi.Add(80 * time.Minute),
+		},
+		{
+			name:     "hanya selang terakhir yang dihitung",
+			riwayat:  panggilan("R1", 0, 3, 6, 36, 66, 96, 126, 156, 159, 162, 165, 168, 171),
+			selang:   30 * time.Minute,
+			terakhir: pagi.Add(171 * time.Minute),
+		},
+		{
+			name:      "riwayat ruang lain tidak tercampur",
+			riwayat:   append(panggilan("R1", 0, 4), panggilan("R2", 0, 20, 40)...),
+			selang:    4 * time.Minute,
+			terakhir:  pagi.Add(4 * time.Minute),
+			ruangLain: 20 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RATA_PELAYANAN", "7")
+			db, _ := bukaDatabasePalsu(t, hasilPalsu{
+				memuat: "panggilan_ke = 1",
+				kolom:  []string{"kd_ruang_poli", "waktu_panggil"},
+				baris:  tt.riwayat,
+			})
+
+			hasil, err := estimasiRuangPoli(db, []string{"R1", "R2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hasil["R1"]; got.selang != tt.selang || !got.panggilTerakhir.Equal(tt.terakhir) {
+				t.Fatalf("selang %v terakhir %v, ingin %v %v", got.selang, got.panggilTerakhir, tt.selang, tt.terakhir)
+			}
+			if tt.ruangLain != 0 && hasil["R2"].selang != tt.ruangLain {
+				t.Fatalf("selang ruang lain %v, ingin %v", hasil["R2"].selang, tt.ruangLain)
+			}
+		})
+	}
+}
+
+func TestPerkiraanEstimasi(t *testing.T) {
+	sekarang := pukul(0, 10, 0)
+
+	tests := []struct {
+		name         string
+		estimasi     estimasiRuang
+		posisi       int
+		tidakSebelum time.Time
+		ingin        time.Time
+	}{
+		{
+			name:     "belum ada panggilan",
+			estimasi: estimasiRuang{selang: 5 * time.Minute},
+			posisi:   3,
+			ingin:    pukul(0, 10, 10),
+		},
+		{
+			name:     "melanjutkan panggilan terakhir",
+			estimasi: estimasiRuang{selang: 5 * time.Minute, panggilTerakhir: pukul(0, 9, 58)},
+			posisi:   1,
+			ingin:    pukul(0, 10, 3),
+		},
+		{
+			name:     "panggilan terakhir sudah lama",
+			estimasi: estimasiRuang{selang: 5 * time.Minute, panggilTerakhir: pukul(0, 9, 0)},
+			posisi:   2,
+			ingin:    pukul(0, 10, 5),
+		},
+		{
+			name:         "tidak sebelum jam mulai praktek",
+			estimasi:     estimasiRuang{selang: 5 * time.Minute, panggilTerakhir: pukul(0, 9, 58)},
+			posisi:       2,
+			tidakSebelum: pukul(0, 13, 0),
+			ingin:        pukul(0, 13, 5),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.estimasi.perkiraan(tt.posisi, tt.tidakSebelum, sekarang); !got.Equal(tt.ingin) {
+				t.Fatalf("perkiraan %v, ingin %v", got, tt.ingin)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// hasilPalsu adalah baris yang dikembalikan database palsu untuk query yang memuat teks tertentu
+type hasilPalsu struct {
+	memuat  string
+	kolom   []string
+	baris   [][]driver.Value
+	terubah int64 // Jumlah baris terubah untuk Exec
+	galat   error // Error yang dikembalikan database, misalnya koneksi terputus
+}
+
+// databasePalsu mencatat setiap query yang dijalankan dan menjawabnya dengan hasilPalsu pertama
+// yang cocok. Query tanpa hasil yang cocok mengembalikan hasil kosong.
+type databasePalsu struct {
+	mu    sync.Mutex
+	hasil []hasilPalsu
+	query []string
+}
+
+var nomorDatabasePalsu int64
+
+// bukaDatabasePalsu membuat koneksi GORM MySQL ke databasePalsu
+func bukaDatabasePalsu(t testing.TB, hasil ...hasilPalsu) (*gorm.DB, *databasePalsu) {
+	t.Helper()
+
+	fake := &databasePalsu{hasil: hasil}
+	nama := fmt.Sprintf("palsu-%d", atomic.AddInt64(&nomorDatabasePalsu, 1))
+	sql.Register(nama, &driverPalsu{db: fake})
+
+	sqlDB, err := sql.Open(nama, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
+
+// Query mengembalikan salinan query yang sudah dijalankan
+func (f *databasePalsu) Query() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.query...)
+}
+
+// cari mencatat query lalu mengembalikan hasil yang cocok
+func (f *databasePalsu) cari(query string) hasilPalsu {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.query = append(f.query, query)
+	for _, h := range f.hasil {
+		if strings.Contains(query, h.memuat) {
+			return h
+		}
+	}
+	return hasilPalsu{}
+}
+
+type driverPalsu struct{ db *databasePalsu }
+
+func (d *driverPalsu) Open(string) (driver.Conn, error) { return &koneksiPalsu{db: d.db}, nil }
+
+type koneksiPalsu struct{ db *databasePalsu }
+
+func (k *koneksiPalsu) Prepare(query string) (driver.Stmt, error) {
+	return &stmtPalsu{db: k.db, query: query}, nil
+}
+func (k *koneksiPalsu) Close() error              { return nil }
+func (k *koneksiPalsu) Begin() (driver.Tx, error) { return txPalsu{}, nil }
+
+func (k *koneksiPalsu) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return barisPalsu(k.db.cari(query))
+}
+
+func (k *koneksiPalsu) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return terubahPalsu(k.db.cari(query))
+}
+
+type txPalsu struct{}
+
+func (txPalsu) Commit() error   { return nil }
+func (txPalsu) Rollback() error { return nil }
+
+type stmtPalsu struct {
+	db    *databasePalsu
+	query string
+}
+
+func (s *stmtPalsu) Close() error  { return nil }
+func (s *stmtPalsu) NumInput() int { return -1 }
+func (s *stmtPalsu) Exec([]driver.Value) (driver.Result, error) {
+	return terubahPalsu(s.db.cari(s.query))
+}
+func (s *stmtPalsu) Query([]driver.Value) (driver.Rows, error) {
+	return barisPalsu(s.db.cari(s.query))
+}
+
+// rowsPalsu mengembalikan baris hasilPalsu satu per satu
+type rowsPalsu struct {
+	kolom []string
+	baris [][]driver.Value
+}
+
+func barisPalsu(h hasilPalsu) (driver.Rows, error) {
+	if h.galat != nil {
+		return nil, h.galat
+	}
+	return &rowsPalsu{kolom: h.kolom, baris: h.baris}, nil
+}
+
+func terubahPalsu(h hasilPalsu) (driver.Result, error) {
+	if h.galat != nil {
+		return nil, h.galat
+	}
+	return driver.RowsAffected(h.terubah), nil
+}
+
+func (r *rowsPalsu) Columns() []string { return r.kolom }
+func (r *rowsPalsu) Close() error      { return nil }
+func (r *rowsPalsu) Next(dest []driver.Value) error {
+	if len(r.baris) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.baris[0])
+	r.baris = r.baris[1:]
+	return nil
+}
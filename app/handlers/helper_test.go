@@ -0,0 +1,8 @@
+package handlers
+
+import "time"
+
+// pukul membuat waktu lokal pada tanggal 19 Oktober 2026 (Senin) ditambah sejumlah hari
+func pukul(hari, jam, menit int) time.Time {
+	return time.Date(2026, time.October, 19+hari, jam, menit, 0, 0, time.Local)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyStore menyimpan response permintaan yang memakai header Idempotency-Key
+// sehingga permintaan ulang dengan kunci yang sama mendapat response yang sama tanpa diproses lagi
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+// idempotencyEntry menyimpan hasil satu permintaan; done ditutup setelah response selesai dibuat
+type idempotencyEntry struct {
+	done        chan struct{}
+	bodyHash    [sha256.Size]byte
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// NewIdempotencyStore membuat instance baru dari IdempotencyStore dengan jangka waktu penyimpanan ttl
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// idempotencyRecorder meneruskan response ke client sambil menyalin isinya
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Middleware mengembalikan gin middleware untuk header Idempotency-Key.
+// Permintaan tanpa header diproses seperti biasa. Response dengan status 5xx tidak disimpan
+// agar client dapat mencoba lagi dengan kunci yang sama.
+func (s *IdempotencyStore) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Gagal membaca body permintaan",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash := sha256.Sum256(body)
+
+		// Path asli dipakai, bukan pola rute, agar kunci yang sama untuk ruang poli lain tidak dianggap ulangan
+		storeKey := c.Request.Method + " " + c.Request.URL.Path + " " + key
+
+		s.mu.Lock()
+		s.hapusKedaluwarsa()
+		entry, exists := s.entries[storeKey]
+		if !exists {
+			entry = &idempotencyEntry{
+				done:     make(chan struct{}),
+				bodyHash: bodyHash,
+			}
+			s.entries[storeKey] = entry
+		}
+		s.mu.Unlock()
+
+		if exists {
+			if entry.bodyHash != bodyHash {
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"status":  "error",
+					"message": "Idempotency-Key sudah dipakai untuk permintaan yang berbeda",
+				})
+				return
+			}
+
+			// Tunggu permintaan pertama selesai lalu kirim ulang response-nya
+			select {
+			case <-entry.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+
+			// Permintaan pertama gagal sehingga response-nya tidak disimpan
+			if entry.status == 0 {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"status":  "error",
+					"message": "Permintaan dengan Idempotency-Key yang sama gagal diproses, silakan coba lagi",
+				})
+				return
+			}
+
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(entry.status, entry.contentType, entry.body)
+			c.Abort()
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// Dijalankan juga saat handler panic agar kunci tidak terblokir dan permintaan yang menunggu dilepas
+		selesai := false
+		defer func() {
+			s.mu.Lock()
+			if !selesai || recorder.Status() >= http.StatusInternalServerError {
+				delete(s.entries, storeKey)
+			} else {
+				entry.status = recorder.Status()
+				entry.contentType = recorder.Header().Get("Content-Type")
+				entry.body = recorder.body.Bytes()
+				entry.expiresAt = time.Now().Add(s.ttl)
+			}
+			s.mu.Unlock()
+			close(entry.done)
+		}()
+
+		c.Next()
+		selesai = true
+	}
+}
+
+// hapusKedaluwarsa menghapus response yang sudah melewati jangka waktu penyimpanan.
+// Harus dipanggil saat mu terkunci.
+func (s *IdempotencyStore) hapusKedaluwarsa() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// routerIdempotency membuat router uji dengan middleware idempotency dan handler yang menghitung pemanggilan
+func routerIdempotency(handler gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.RecoveryWithWriter(io.Discard))
+	r.POST("/api/antrian/:kd_ruang_poli/next", NewIdempotencyStore(time.Minute).Middleware(), handler)
+	return r
+}
+
+// kirimIdempotency mengirim POST dengan Idempotency-Key dan body JSON
+func kirimIdempotency(r http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	// Batas waktu agar permintaan yang menunggu kunci terblokir gagal, bukan menggantung
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	type permintaan struct {
+		path, key, body string
+		status          int
+		replayed        bool
+	}
+
+	tests := []struct {
+		name      string
+		handler   func(c *gin.Context, n int32)
+		requests  []permintaan
+		jumlahRun int32
+	}{
+		{
+			name: "kunci sama diulang tanpa diproses lagi",
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusOK, false},
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusOK, true},
+			},
+			jumlahRun: 1,
+		},
+		{
+			name: "kunci sama untuk ruang poli lain diproses terpisah",
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusOK, false},
+				{"/api/antrian/R2/next", "k1", "{}", http.StatusOK, false},
+			},
+			jumlahRun: 2,
+		},
+		{
+			name: "kunci sama dengan body berbeda ditolak",
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "k1", `{"a":1}`, http.StatusOK, false},
+				{"/api/antrian/R1/next", "k1", `{"a":2}`, http.StatusUnprocessableEntity, false},
+			},
+			jumlahRun: 1,
+		},
+		{
+			name: "tanpa kunci selalu diproses",
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "", "{}", http.StatusOK, false},
+				{"/api/antrian/R1/next", "", "{}", http.StatusOK, false},
+			},
+			jumlahRun: 2,
+		},
+		{
+			name: "response 5xx tidak disimpan",
+			handler: func(c *gin.Context, n int32) {
+				if n == 1 {
+					c.JSON(http.StatusInternalServerError, gin.H{"status": "error"})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"status": "success"})
+			},
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusInternalServerError, false},
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusOK, false},
+			},
+			jumlahRun: 2,
+		},
+		{
+			name: "handler panic tidak memblokir kunci",
+			handler: func(c *gin.Context, n int32) {
+				if n == 1 {
+					panic("gagal")
+				}
+				c.JSON(http.StatusOK, gin.H{"status": "success"})
+			},
+			requests: []permintaan{
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusInternalServerError, false},
+				{"/api/antrian/R1/next", "k1", "{}", http.StatusOK, false},
+			},
+			jumlahRun: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jumlah int32
+			r := routerIdempotency(func(c *gin.Context) {
+				n := atomic.AddInt32(&jumlah, 1)
+				if tt.handler != nil {
+					tt.handler(c, n)
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"ruang": c.Param("kd_ruang_poli"), "ke": n})
+			})
+
+			var pertama string
+			for i, p := range tt.requests {
+				w := kirimIdempotency(r, p.path, p.key, p.body)
+				if w.Code != p.status {
+					t.Fatalf("permintaan %d: status %d, ingin %d", i, w.Code, p.status)
+				}
+				if got := w.Header().Get("Idempotent-Replayed") == "true"; got != p.replayed {
+					t.Fatalf("permintaan %d: replayed %v, ingin %v", i, got, p.replayed)
+				}
+				if i == 0 {
+					pertama = w.Body.String()
+				} else if p.replayed && w.Body.String() != pertama {
+					t.Fatalf("permintaan %d: body ulangan %q, ingin %q", i, w.Body.String(), pertama)
+				}
+			}
+
+			if got := atomic.LoadInt32(&jumlah); got != tt.jumlahRun {
+				t.Fatalf("handler dijalankan %d kali, ingin %d", got, tt.jumlahRun)
+			}
+		})
+	}
+}
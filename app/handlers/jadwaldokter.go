@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -10,7 +11,16 @@ import (
 	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
 )
 
-// JadwalDokterHandler menangani tampilan jadwal dokter
+// pesanJadwalLokalTidakDitemukan dikirim saat jadwal yang diubah atau dihapus tidak ada di bw_jadwal_dokter
+const pesanJadwalLokalTidakDitemukan = "Jadwal tidak ditemukan pada jadwal lokal. Jadwal dari Khanza hanya dapat diubah melalui SIMRS Khanza"
+
+// pesanJadwalLokalTidakDipakai dikirim saat jadwal diubah padahal jadwal lokal tidak dibaca display
+const pesanJadwalLokalTidakDipakai = "Jadwal lokal tidak dipakai display karena SUMBER_JADWAL tidak memuat lokal. " +
+	"Ubah jadwal melalui SIMRS Khanza atau tambahkan lokal pada SUMBER_JADWAL"
+
+// JadwalDokterHandler menangani tampilan jadwal dokter. Jadwal dibaca dari sumber jadwal yang dikonfigurasi
+// (services.QueryJadwalDokter) dan diberi label sumbernya, sedangkan perubahan hanya dapat dilakukan pada
+// jadwal lokal di bw_jadwal_dokter yang dipakai display jika SUMBER_JADWAL memuat lokal.
 type JadwalDokterHandler struct {
 	DB *gorm.DB
 }
@@ -34,8 +44,22 @@ func (h *JadwalDokterHandler) HandleJadwal(c *gin.Context) {
 	})
 }
 
+// pastikanJadwalLokalDipakai menolak perubahan jadwal dengan 409 jika SUMBER_JADWAL tidak memuat lokal,
+// karena perubahan pada bw_jadwal_dokter tidak akan tampil di display
+func pastikanJadwalLokalDipakai(c *gin.Context) bool {
+	if services.SumberJadwalDipakai(services.SumberJadwalLokal) {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": pesanJadwalLokalTidakDipakai})
+	return false
+}
+
 // UbahJadwalDokter mengedit jadwal dokter yang ada
 func (h *JadwalDokterHandler) UbahJadwalDokter(c *gin.Context) {
+	if !pastikanJadwalLokalDipakai(c) {
+		return
+	}
+
 	var input struct {
 		KdDokter       string `json:"kd_dokter" binding:"required"`
 		HariKerja      string `json:"hari_kerja" binding:"required"`
@@ -50,18 +74,65 @@ func (h *JadwalDokterHandler) UbahJadwalDokter(c *gin.Context) {
 		return
 	}
 
-	result := h.DB.Table("bw_jadwal_dokter").
-		Where("kd_dokter = ?", input.KdDokter).
-		Where("hari_kerja = ?", input.HariKerja).
-		Where("jam_mulai = ?", input.JamMulai).
-		Where("jam_selesai = ?", input.JamSelesai).
-		Updates(map[string]interface{}{
-			"jam_mulai":   input.JamMulaiBaru,
-			"jam_selesai": input.JamSelesaiBaru,
-		})
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	lama := barisJadwalDokter{
+		KdDokter:   input.KdDokter,
+		HariKerja:  input.HariKerja,
+		JamMulai:   input.JamMulai,
+		JamSelesai: input.JamSelesai,
+	}
+	baru := lama
+	baru.JamMulai = input.JamMulaiBaru
+	baru.JamSelesai = input.JamSelesaiBaru
+
+	var galat map[string]string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		galat, err = validasiJadwalDokter(tx, &baru, &lama)
+		if err != nil || len(galat) > 0 {
+			return err
+		}
+
+		result := tx.Table("bw_jadwal_dokter").
+			Where("kd_dokter = ?", input.KdDokter).
+			Where("hari_kerja = ?", input.HariKerja).
+			Where("jam_mulai = ?", input.JamMulai).
+			Where("jam_selesai = ?", input.JamSelesai).
+			Updates(map[string]interface{}{
+				"jam_mulai":   baru.JamMulai,
+				"jam_selesai": baru.JamSelesai,
+			})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+
+		// MySQL tidak menghitung baris yang nilainya tidak berubah, jadi periksa apakah jadwal baru sudah ada
+		var jumlah int64
+		err = tx.Table("bw_jadwal_dokter").
+			Where("kd_dokter = ? AND hari_kerja = ? AND jam_mulai = ? AND jam_selesai = ?",
+				input.KdDokter, input.HariKerja, baru.JamMulai, baru.JamSelesai).
+			Count(&jumlah).Error
+		if err == nil && jumlah == 0 {
+			err = errJadwalLokalTidakDitemukan
+		}
+		return err
+	})
+	if errors.Is(err, errJadwalLokalTidakDitemukan) {
+		c.JSON(http.StatusNotFound, gin.H{"error": pesanJadwalLokalTidakDitemukan})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(galat) > 0 {
+		// Field jam pada jadwal baru dikirim sebagai jam_mulai_baru dan jam_selesai_baru
+		for field, baruField := range map[string]string{"jam_mulai": "jam_mulai_baru", "jam_selesai": "jam_selesai_baru"} {
+			if pesan, ok := galat[field]; ok {
+				galat[baruField] = pesan
+				delete(galat, field)
+			}
+		}
+		responsJadwalTidakValid(c, galat)
 		return
 	}
 
@@ -70,6 +141,10 @@ func (h *JadwalDokterHandler) UbahJadwalDokter(c *gin.Context) {
 
 // HapusJadwalDokter menghapus jadwal dokter
 func (h *JadwalDokterHandler) HapusJadwalDokter(c *gin.Context) {
+	if !pastikanJadwalLokalDipakai(c) {
+		return
+	}
+
 	var input struct {
 		KdDokter   string `json:"kd_dokter" binding:"required"`
 		HariKerja  string `json:"hari_kerja" binding:"required"`
@@ -93,6 +168,10 @@ func (h *JadwalDokterHandler) HapusJadwalDokter(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": pesanJadwalLokalTidakDitemukan})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Jadwal berhasil dihapus"})
 }
@@ -103,11 +182,12 @@ func (h *JadwalDokterHandler) CariDokter(c *gin.Context) {
 
 	var dokter []map[string]interface{}
 	query := h.DB.Table("dokter").
-		Select("dokter.kd_dokter, dokter.nm_dokter, dokter.status, " +
-			"GROUP_CONCAT(DISTINCT CONCAT(bw_jadwal_dokter.hari_kerja, ' ', bw_jadwal_dokter.jam_mulai, '-', bw_jadwal_dokter.jam_selesai) SEPARATOR ', ') as jadwal, " +
+		Select("dokter.kd_dokter, dokter.nm_dokter, dokter.status, "+
+			"GROUP_CONCAT(DISTINCT CONCAT(jadwal.hari_kerja, ' ', jadwal.jam_mulai, '-', jadwal.jam_selesai) SEPARATOR ', ') as jadwal, "+
+			"GROUP_CONCAT(DISTINCT jadwal.sumber SEPARATOR ', ') as sumber, "+
 			"GROUP_CONCAT(DISTINCT poliklinik.nm_poli SEPARATOR ', ') as poli").
-		Joins("LEFT JOIN bw_jadwal_dokter ON dokter.kd_dokter = bw_jadwal_dokter.kd_dokter").
-		Joins("LEFT JOIN poliklinik ON bw_jadwal_dokter.kd_poli = poliklinik.kd_poli")
+		Joins("LEFT JOIN (?) AS jadwal ON dokter.kd_dokter = jadwal.kd_dokter", services.QueryJadwalDokter(h.DB)).
+		Joins("LEFT JOIN poliklinik ON jadwal.kd_poli = poliklinik.kd_poli")
 
 	if cariKode != "" {
 		query = query.Where("dokter.kd_dokter LIKE ? OR dokter.nm_dokter LIKE ?", "%"+cariKode+"%", "%"+cariKode+"%")
@@ -128,6 +208,10 @@ func (h *JadwalDokterHandler) CariDokter(c *gin.Context) {
 
 // TambahJadwalDokter menambahkan jadwal dokter baru
 func (h *JadwalDokterHandler) TambahJadwalDokter(c *gin.Context) {
+	if !pastikanJadwalLokalDipakai(c) {
+		return
+	}
+
 	var input struct {
 		KdDokter   string `json:"kd_dokter" binding:"required"`
 		HariKerja  string `json:"hari_kerja" binding:"required"`
@@ -141,46 +225,67 @@ func (h *JadwalDokterHandler) TambahJadwalDokter(c *gin.Context) {
 		return
 	}
 
-	result := h.DB.Table("bw_jadwal_dokter").Create(map[string]interface{}{
-		"kd_dokter":   input.KdDokter,
-		"hari_kerja":  input.HariKerja,
-		"jam_mulai":   input.JamMulai + ":00",
-		"jam_selesai": input.JamSelesai + ":00",
-		"kd_poli":     input.KdPoli,
+	jadwal := barisJadwalDokter{
+		KdDokter:   input.KdDokter,
+		HariKerja:  input.HariKerja,
+		JamMulai:   input.JamMulai,
+		JamSelesai: input.JamSelesai,
+		KdPoli:     input.KdPoli,
+	}
+	var galat map[string]string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		galat, err = validasiJadwalDokter(tx, &jadwal, nil)
+		if err != nil || len(galat) > 0 {
+			return err
+		}
+
+		return tx.Table("bw_jadwal_dokter").Create(map[string]interface{}{
+			"kd_dokter":   jadwal.KdDokter,
+			"hari_kerja":  jadwal.HariKerja,
+			"jam_mulai":   jadwal.JamMulai,
+			"jam_selesai": jadwal.JamSelesai,
+			"kd_poli":     jadwal.KdPoli,
+		}).Error
 	})
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(galat) > 0 {
+		responsJadwalTidakValid(c, galat)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Jadwal berhasil ditambahkan"})
 }
 
-// GetJadwalDokter mengembalikan daftar jadwal semua dokter atau jadwal spesifik dokter
+// GetJadwalDokter mengembalikan daftar jadwal semua dokter atau jadwal spesifik dokter.
+// Kolom sumber menunjukkan asal jadwal; hanya jadwal lokal yang dapat diubah atau dihapus.
 func (h *JadwalDokterHandler) GetJadwalDokter(c *gin.Context) {
 	kdDokter := c.Query("kd_dokter")
 	hari := c.Query("hari")
 
-	query := h.DB.Table("bw_jadwal_dokter").
+	query := h.DB.Table("(?) AS jadwal", services.QueryJadwalDokter(h.DB)).
 		Select(`
             dokter.kd_dokter,
             dokter.nm_dokter,
-            bw_jadwal_dokter.hari_kerja,
-            bw_jadwal_dokter.jam_mulai,
-            bw_jadwal_dokter.jam_selesai,
+            jadwal.hari_kerja,
+            jadwal.jam_mulai,
+            jadwal.jam_selesai,
             poliklinik.kd_poli,
-            poliklinik.nm_poli
+            poliklinik.nm_poli,
+            jadwal.sumber
         `).
-		Joins("JOIN dokter ON bw_jadwal_dokter.kd_dokter = dokter.kd_dokter").
-		Joins("JOIN poliklinik ON bw_jadwal_dokter.kd_poli = poliklinik.kd_poli").
+		Joins("JOIN dokter ON jadwal.kd_dokter = dokter.kd_dokter").
+		Joins("JOIN poliklinik ON jadwal.kd_poli = poliklinik.kd_poli").
 		Where("dokter.status = ?", "1")
 
 	if kdDokter != "" {
 		query = query.Where("dokter.kd_dokter = ?", kdDokter)
 	}
 	if hari != "" {
-		query = query.Where("bw_jadwal_dokter.hari_kerja = ?", hari)
+		query = query.Where("jadwal.hari_kerja = ?", hari)
 	}
 
 	var jadwal []map[string]interface{}
@@ -200,11 +305,11 @@ func (h *JadwalDokterHandler) GetJadwalDokter(c *gin.Context) {
 // getDokterByHari mendapatkan daftar dokter berdasarkan hari
 func (h *JadwalDokterHandler) getDokterByHari(hari string) []map[string]interface{} {
 	var results []map[string]interface{}
-	h.DB.Table("bw_jadwal_dokter").
-		Select("dokter.nm_dokter, bw_jadwal_dokter.kd_dokter, bw_jadwal_dokter.hari_kerja, bw_jadwal_dokter.jam_mulai, bw_jadwal_dokter.jam_selesai, poliklinik.nm_poli").
-		Joins("JOIN dokter ON bw_jadwal_dokter.kd_dokter = dokter.kd_dokter").
-		Joins("JOIN poliklinik ON bw_jadwal_dokter.kd_poli = poliklinik.kd_poli").
-		Where("bw_jadwal_dokter.hari_kerja = ?", hari).
+	h.DB.Table("(?) AS jadwal", services.QueryJadwalDokter(h.DB)).
+		Select("dokter.nm_dokter, jadwal.kd_dokter, jadwal.hari_kerja, jadwal.jam_mulai, jadwal.jam_selesai, poliklinik.nm_poli, jadwal.sumber").
+		Joins("JOIN dokter ON jadwal.kd_dokter = dokter.kd_dokter").
+		Joins("JOIN poliklinik ON jadwal.kd_poli = poliklinik.kd_poli").
+		Where("jadwal.hari_kerja = ?", hari).
 		Find(&results)
 
 	return results
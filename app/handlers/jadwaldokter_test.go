@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUbahHapusJadwalDokter(t *testing.T) {
+	jadwal := `{"kd_dokter":"D001","hari_kerja":"SENIN","jam_mulai":"08:00:00","jam_selesai":"12:00:00"}`
+	ubah := `{"kd_dokter":"D001","hari_kerja":"SENIN","jam_mulai":"08:00:00","jam_selesai":"12:00:00",` +
+		`"jam_mulai_baru":"09:00","jam_selesai_baru":"13:00"}`
+
+	tests := []struct {
+		name   string
+		sumber string
+		method string
+		body   string
+		hasil  []hasilPalsu
+		status int
+	}{
+		{
+			name:   "hapus jadwal lokal",
+			method: http.MethodDelete,
+			body:   jadwal,
+			hasil:  []hasilPalsu{{memuat: "DELETE FROM `bw_jadwal_dokter`", terubah: 1}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "hapus jadwal yang tidak ada di jadwal lokal",
+			method: http.MethodDelete,
+			body:   jadwal,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "ubah jadwal lokal",
+			method: http.MethodPut,
+			body:   ubah,
+			hasil:  []hasilPalsu{{memuat: "UPDATE `bw_jadwal_dokter`", terubah: 1}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "ubah jadwal yang tidak ada di jadwal lokal",
+			method: http.MethodPut,
+			body:   ubah,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "ubah tanpa perubahan jam",
+			method: http.MethodPut,
+			body:   ubah,
+			hasil:  []hasilPalsu{{memuat: "count(*)", kolom: []string{"count(*)"}, baris: [][]driver.Value{{int64(1)}}}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "ubah saat jadwal lokal tidak dipakai",
+			sumber: "khanza",
+			method: http.MethodPut,
+			body:   ubah,
+			hasil:  []hasilPalsu{{memuat: "UPDATE `bw_jadwal_dokter`", terubah: 1}},
+			status: http.StatusConflict,
+		},
+		{
+			name:   "hapus saat jadwal lokal tidak dipakai",
+			sumber: "khanza",
+			method: http.MethodDelete,
+			body:   jadwal,
+			hasil:  []hasilPalsu{{memuat: "DELETE FROM `bw_jadwal_dokter`", terubah: 1}},
+			status: http.StatusConflict,
+		},
+		{
+			name:   "tambah saat jadwal lokal tidak dipakai",
+			sumber: "khanza",
+			method: http.MethodPost,
+			body:   `{"kd_dokter":"D001","hari_kerja":"SENIN","jam_mulai":"08:00","jam_selesai":"12:00","kd_poli":"U001"}`,
+			status: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sumber == "" {
+				tt.sumber = "lokal,khanza"
+			}
+			t.Setenv("SUMBER_JADWAL", tt.sumber)
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			h := NewJadwalDokterHandler(db)
+
+			r := gin.New()
+			r.POST("/api/jadwal/", h.TambahJadwalDokter)
+			r.PUT("/api/jadwal/", h.UbahJadwalDokter)
+			r.DELETE("/api/jadwal/", h.HapusJadwalDokter)
+
+			req := httptest.NewRequest(tt.method, "/api/jadwal/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusConflict && len(fake.Query()) != 0 {
+				t.Fatalf("jadwal diubah meskipun jadwal lokal tidak dipakai: %q", fake.Query())
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// JadwalOperasiDisplayHandler menangani jadwal operasi display serta mode standby di luar jam operasi
+type JadwalOperasiDisplayHandler struct {
+	DB     *gorm.DB
+	Socket *DisplaySocketHub
+
+	mu              sync.Mutex
+	standbyTerkirim map[string]bool // Status standby terakhir yang dikirim per display
+}
+
+// NewJadwalOperasiDisplayHandler membuat instance baru dari JadwalOperasiDisplayHandler
+func NewJadwalOperasiDisplayHandler(db *gorm.DB) *JadwalOperasiDisplayHandler {
+	return &JadwalOperasiDisplayHandler{
+		DB:              db,
+		standbyTerkirim: make(map[string]bool),
+	}
+}
+
+// SetSocketHub menetapkan hub WebSocket display dan mendaftarkan pengiriman status standby saat display terhubung
+func (h *JadwalOperasiDisplayHandler) SetSocketHub(socket *DisplaySocketHub) {
+	h.Socket = socket
+	socket.TambahPesanAwal(h.pesanStatusOperasi)
+}
+
+// statusOperasi adalah status operasi display pada suatu waktu
+type statusOperasi struct {
+	Standby bool       `json:"standby"`
+	Bangun  *time.Time `json:"bangun"` // Waktu display menyala kembali, hanya saat standby
+	Tidur   *time.Time `json:"tidur"`  // Waktu display masuk standby, hanya saat menyala
+}
+
+// jamPada menggabungkan tanggal dengan jam berformat HH:MM
+func jamPada(tanggal time.Time, jam string) (time.Time, error) {
+	t, err := time.ParseInLocation("15:04", jam, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(tanggal.Year(), tanggal.Month(), tanggal.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
+
+// hitungStatusOperasi menentukan apakah display sedang standby beserta waktu perubahan berikutnya.
+// Display tanpa jadwal operasi selalu menyala.
+func hitungStatusOperasi(jadwal []models.JadwalOperasiDisplay, sekarang time.Time) statusOperasi {
+	var status statusOperasi
+	if len(jadwal) == 0 {
+		return status
+	}
+	status.Standby = true
+
+	hariList := services.GetDayList()
+	awal := time.Date(sekarang.Year(), sekarang.Month(), sekarang.Day(), 0, 0, 0, 0, time.Local)
+
+	// Periksa hari ini sampai seminggu ke depan untuk mencari jam buka berikutnya
+	for i := 0; i <= 7 && status.Bangun == nil; i++ {
+		tanggal := awal.AddDate(0, 0, i)
+		hari := hariList[tanggal.Format("Monday")]
+
+		for _, j := range jadwal {
+			if j.HariKerja != hari {
+				continue
+			}
+			buka, errBuka := jamPada(tanggal, j.JamBuka)
+			tutup, errTutup := jamPada(tanggal, j.JamTutup)
+			if errBuka != nil || errTutup != nil {
+				continue
+			}
+
+			if !sekarang.Before(buka) && sekarang.Before(tutup) {
+				status.Standby = false
+				status.Tidur = &tutup
+			}
+			if buka.After(sekarang) && (status.Bangun == nil || buka.Before(*status.Bangun)) {
+				status.Bangun = &buka
+			}
+		}
+	}
+
+	if !status.Standby {
+		status.Bangun = nil
+	}
+	return status
+}
+
+// getJadwalOperasi mengambil jadwal operasi display
+func getJadwalOperasi(db *gorm.DB, kdDisplay string) ([]models.JadwalOperasiDisplay, error) {
+	jadwal := []models.JadwalOperasiDisplay{}
+	err := db.Where("kd_display = ?", kdDisplay).Order("id asc").Find(&jadwal).Error
+	return jadwal, err
+}
+
+// displayStandby menentukan display yang sedang standby dari beberapa display sekaligus
+func displayStandby(db *gorm.DB, kdDisplayList []string, sekarang time.Time) (map[string]bool, error) {
+	hasil := make(map[string]bool, len(kdDisplayList))
+	if len(kdDisplayList) == 0 {
+		return hasil, nil
+	}
+
+	var jadwal []models.JadwalOperasiDisplay
+	if err := db.Where("kd_display IN ?", kdDisplayList).Find(&jadwal).Error; err != nil {
+		return hasil, err
+	}
+
+	jadwalDisplay := make(map[string][]models.JadwalOperasiDisplay)
+	for _, j := range jadwal {
+		jadwalDisplay[j.KdDisplay] = append(jadwalDisplay[j.KdDisplay], j)
+	}
+	for _, kd := range kdDisplayList {
+		hasil[kd] = hitungStatusOperasi(jadwalDisplay[kd], sekarang).Standby
+	}
+	return hasil, nil
+}
+
+// validasiJadwalOperasi memeriksa hari dan jam operasi serta memastikan jam operasi
+// pada hari yang sama tidak bertumpuk. Nama hari diseragamkan menjadi huruf besar.
+func validasiJadwalOperasi(jadwal []models.JadwalOperasiDisplay) error {
+	hariValid := make(map[string]bool)
+	for _, hari := range services.GetDayList() {
+		hariValid[hari] = true
+	}
+
+	perHari := make(map[string][]models.JadwalOperasiDisplay)
+	for i := range jadwal {
+		jadwal[i].HariKerja = strings.ToUpper(strings.TrimSpace(jadwal[i].HariKerja))
+		j := jadwal[i]
+
+		if !hariValid[j.HariKerja] {
+			return errors.New("hari " + j.HariKerja + " tidak dikenal")
+		}
+		buka, err := time.Parse("15:04", j.JamBuka)
+		if err != nil {
+			return errors.New("jam buka harus dalam format HH:MM")
+		}
+		tutup, err := time.Parse("15:04", j.JamTutup)
+		if err != nil {
+			return errors.New("jam tutup harus dalam format HH:MM")
+		}
+		if !buka.Before(tutup) {
+			return errors.New("jam buka harus sebelum jam tutup pada hari " + j.HariKerja)
+		}
+		perHari[j.HariKerja] = append(perHari[j.HariKerja], j)
+	}
+
+	// Jam operasi yang bersambung juga ditolak agar waktu standby berikutnya selalu tepat
+	for hari, list := range perHari {
+		sort.Slice(list, func(a, b int) bool { return list[a].JamBuka < list[b].JamBuka })
+		for i := 1; i < len(list); i++ {
+			if list[i].JamBuka <= list[i-1].JamTutup {
+				return errors.New("jam operasi hari " + hari + " bertumpuk atau bersambung, gabungkan menjadi satu")
+			}
+		}
+	}
+	return nil
+}
+
+// getStatusOperasi menghitung status standby display saat ini dari jadwal operasinya
+func (h *JadwalOperasiDisplayHandler) getStatusOperasi(kdDisplay string) (statusOperasi, error) {
+	jadwal, err := getJadwalOperasi(h.DB, kdDisplay)
+	if err != nil {
+		return statusOperasi{}, err
+	}
+	return hitungStatusOperasi(jadwal, time.Now()), nil
+}
+
+// pesanStatusOperasi membuat pesan WebSocket berisi status standby display
+func (h *JadwalOperasiDisplayHandler) pesanStatusOperasi(kdDisplay string) interface{} {
+	status, err := h.getStatusOperasi(kdDisplay)
+	if err != nil {
+		log.Printf("Gagal mengambil jadwal operasi display %s: %v", kdDisplay, err)
+		return nil
+	}
+
+	return pesanDisplay{
+		Type:      "standby",
+		KdDisplay: kdDisplay,
+		Data:      status,
+	}
+}
+
+// kirimStatusOperasi mengirim status standby ke display jika berubah dari yang terakhir dikirim.
+// paksa mengirim status walaupun sama, dipakai setelah jadwal operasi diubah melalui API.
+func (h *JadwalOperasiDisplayHandler) kirimStatusOperasi(kdDisplay string, paksa bool) {
+	status, err := h.getStatusOperasi(kdDisplay)
+	if err != nil {
+		log.Printf("Gagal mengambil jadwal operasi display %s: %v", kdDisplay, err)
+		return
+	}
+
+	h.mu.Lock()
+	terkirim, ada := h.standbyTerkirim[kdDisplay]
+	h.standbyTerkirim[kdDisplay] = status.Standby
+	h.mu.Unlock()
+
+	if ada && terkirim == status.Standby && !paksa {
+		return
+	}
+	h.Socket.KirimKeDisplay(kdDisplay, pesanDisplay{
+		Type:      "standby",
+		KdDisplay: kdDisplay,
+		Data:      status,
+	})
+}
+
+// MulaiPenjadwalanOperasi memeriksa secara berkala display yang masuk atau keluar dari jam operasi
+// dan mengirim status standby ke display yang terhubung
+func (h *JadwalOperasiDisplayHandler) MulaiPenjadwalanOperasi(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, kdDisplay := range h.Socket.DisplayTerhubung() {
+			h.kirimStatusOperasi(kdDisplay, false)
+		}
+	}
+}
+
+// GetJadwalOperasi mengembalikan jadwal operasi display dalam format JSON
+func (h *JadwalOperasiDisplayHandler) GetJadwalOperasi(c *gin.Context) {
+	jadwal, err := getJadwalOperasi(h.DB, c.Param("kd_display"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jadwal)
+}
+
+// SimpanJadwalOperasi mengganti seluruh jadwal operasi display dan mengirim status standby terbaru
+// ke display yang terhubung. Daftar kosong membuat display selalu menyala.
+func (h *JadwalOperasiDisplayHandler) SimpanJadwalOperasi(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	var jadwal []models.JadwalOperasiDisplay
+	if err := c.ShouldBindJSON(&jadwal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Format jadwal operasi tidak valid",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if err := validasiJadwalOperasi(jadwal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jadwal operasi tidak valid: " + err.Error(),
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	var jumlah int64
+	h.DB.Table("bw_display_poli").Where("kd_display = ?", kdDisplay).Count(&jumlah)
+	if jumlah == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Display tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	for i := range jadwal {
+		jadwal[i].ID = 0
+		jadwal[i].KdDisplay = kdDisplay
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kd_display = ?", kdDisplay).Delete(&models.JadwalOperasiDisplay{}).Error; err != nil {
+			return err
+		}
+		if len(jadwal) == 0 {
+			return nil
+		}
+		return tx.Create(&jadwal).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan jadwal operasi display",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.kirimStatusOperasi(kdDisplay, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Jadwal operasi display berhasil disimpan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
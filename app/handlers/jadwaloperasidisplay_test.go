@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+func TestHitungStatusOperasi(t *testing.T) {
+	jadwal := func(hariJam ...string) []models.JadwalOperasiDisplay {
+		var list []models.JadwalOperasiDisplay
+		for i := 0; i+2 < len(hariJam); i += 3 {
+			list = append(list, models.JadwalOperasiDisplay{HariKerja: hariJam[i], JamBuka: hariJam[i+1], JamTutup: hariJam[i+2]})
+		}
+		return list
+	}
+	waktu := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name     string
+		jadwal   []models.JadwalOperasiDisplay
+		sekarang time.Time
+		ingin    statusOperasi
+	}{
+		{
+			name:     "tanpa jadwal selalu menyala",
+			sekarang: pukul(0, 3, 0),
+			ingin:    statusOperasi{},
+		},
+		{
+			name:     "dalam jam operasi",
+			jadwal:   jadwal("SENIN", "08:00", "16:00"),
+			sekarang: pukul(0, 10, 0),
+			ingin:    statusOperasi{Tidur: waktu(pukul(0, 16, 0))},
+		},
+		{
+			name:     "tepat jam buka menyala",
+			jadwal:   jadwal("SENIN", "08:00", "16:00"),
+			sekarang: pukul(0, 8, 0),
+			ingin:    statusOperasi{Tidur: waktu(pukul(0, 16, 0))},
+		},
+		{
+			name:     "sebelum jam buka",
+			jadwal:   jadwal("SENIN", "08:00", "16:00"),
+			sekarang: pukul(0, 7, 0),
+			ingin:    statusOperasi{Standby: true, Bangun: waktu(pukul(0, 8, 0))},
+		},
+		{
+			name:     "tepat jam tutup bangun minggu depan",
+			jadwal:   jadwal("SENIN", "08:00", "16:00"),
+			sekarang: pukul(0, 16, 0),
+			ingin:    statusOperasi{Standby: true, Bangun: waktu(pukul(7, 8, 0))},
+		},
+		{
+			name:     "istirahat di antara dua jam operasi",
+			jadwal:   jadwal("SENIN", "08:00", "12:00", "SENIN", "13:00", "16:00"),
+			sekarang: pukul(0, 12, 30),
+			ingin:    statusOperasi{Standby: true, Bangun: waktu(pukul(0, 13, 0))},
+		},
+		{
+			name:     "bangun pada hari operasi berikutnya",
+			jadwal:   jadwal("SELASA", "07:30", "14:00", "KAMIS", "07:30", "14:00"),
+			sekarang: pukul(0, 20, 0),
+			ingin:    statusOperasi{Standby: true, Bangun: waktu(pukul(1, 7, 30))},
+		},
+		{
+			name:     "jam tidak valid diabaikan",
+			jadwal:   jadwal("SENIN", "8 pagi", "16:00"),
+			sekarang: pukul(0, 10, 0),
+			ingin:    statusOperasi{Standby: true},
+		},
+	}
+
+	sama := func(a, b *time.Time) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hitungStatusOperasi(tt.jadwal, tt.sekarang)
+			if got.Standby != tt.ingin.Standby || !sama(got.Bangun, tt.ingin.Bangun) || !sama(got.Tidur, tt.ingin.Tidur) {
+				t.Fatalf("status %+v (bangun %v, tidur %v), ingin %+v (bangun %v, tidur %v)",
+					got.Standby, got.Bangun, got.Tidur, tt.ingin.Standby, tt.ingin.Bangun, tt.ingin.Tidur)
+			}
+		})
+	}
+}
+
+func TestValidasiJadwalOperasi(t *testing.T) {
+	tests := []struct {
+		name   string
+		jadwal []models.JadwalOperasiDisplay
+		valid  bool
+	}{
+		{"kosong", nil, true},
+		{"hari huruf kecil diseragamkan", []models.JadwalOperasiDisplay{{HariKerja: " senin ", JamBuka: "08:00", JamTutup: "16:00"}}, true},
+		{"dua jam operasi terpisah", []models.JadwalOperasiDisplay{
+			{HariKerja: "SENIN", JamBuka: "13:00", JamTutup: "16:00"},
+			{HariKerja: "SENIN", JamBuka: "08:00", JamTutup: "12:00"},
+		}, true},
+		{"hari tidak dikenal", []models.JadwalOperasiDisplay{{HariKerja: "MINGGU", JamBuka: "08:00", JamTutup: "16:00"}}, false},
+		{"format jam salah", []models.JadwalOperasiDisplay{{HariKerja: "SENIN", JamBuka: "8", JamTutup: "16:00"}}, false},
+		{"jam buka setelah jam tutup", []models.JadwalOperasiDisplay{{HariKerja: "SENIN", JamBuka: "16:00", JamTutup: "08:00"}}, false},
+		{"bertumpuk", []models.JadwalOperasiDisplay{
+			{HariKerja: "SENIN", JamBuka: "08:00", JamTutup: "12:00"},
+			{HariKerja: "SENIN", JamBuka: "11:00", JamTutup: "16:00"},
+		}, false},
+		{"bersambung", []models.JadwalOperasiDisplay{
+			{HariKerja: "SENIN", JamBuka: "08:00", JamTutup: "12:00"},
+			{HariKerja: "SENIN", JamBuka: "12:00", JamTutup: "16:00"},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validasiJadwalOperasi(tt.jadwal)
+			if (err == nil) != tt.valid {
+				t.Fatalf("error %v, ingin valid %v", err, tt.valid)
+			}
+			for _, j := range tt.jadwal {
+				if err == nil && j.HariKerja != "SENIN" {
+					t.Fatalf("hari %q tidak diseragamkan", j.HariKerja)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// errRuangDijeda dikembalikan jika panggilan dilakukan saat antrian ruang poli sedang dijeda
+var errRuangDijeda = errors.New("antrian ruang poli sedang dijeda")
+
+// JedaRuangPoliHandler menangani jeda dan lanjut antrian ruang poli
+type JedaRuangPoliHandler struct {
+	DB       *gorm.DB
+	Snapshot *DisplaySnapshotCache // Snapshot display yang ditandai berubah saat ruang poli dijeda atau dilanjutkan
+}
+
+// NewJedaRuangPoliHandler membuat instance baru dari JedaRuangPoliHandler
+func NewJedaRuangPoliHandler(db *gorm.DB) *JedaRuangPoliHandler {
+	return &JedaRuangPoliHandler{DB: db}
+}
+
+// SetSnapshotCache menetapkan cache snapshot display untuk handler ini
+func (h *JedaRuangPoliHandler) SetSnapshotCache(snapshot *DisplaySnapshotCache) {
+	h.Snapshot = snapshot
+}
+
+// cariJedaRuangPoli mengambil data jeda ruang poli, nil jika ruang poli tidak sedang dijeda
+func cariJedaRuangPoli(db *gorm.DB, kdRuangPoli string) (*models.JedaRuangPoli, error) {
+	var jeda []models.JedaRuangPoli
+	if err := db.Where("kd_ruang_poli = ?", kdRuangPoli).Limit(1).Find(&jeda).Error; err != nil {
+		return nil, err
+	}
+	if len(jeda) == 0 {
+		return nil, nil
+	}
+	return &jeda[0], nil
+}
+
+// jedaRuangPoliList mengambil data jeda beberapa ruang poli sekaligus.
+// Ruang poli yang tidak sedang dijeda tidak memiliki entri pada hasil.
+func jedaRuangPoliList(db *gorm.DB, kdRuangPoliList []string) (map[string]*models.JedaRuangPoli, error) {
+	hasil := make(map[string]*models.JedaRuangPoli)
+	if len(kdRuangPoliList) == 0 {
+		return hasil, nil
+	}
+
+	var jeda []models.JedaRuangPoli
+	if err := db.Where("kd_ruang_poli IN ?", kdRuangPoliList).Find(&jeda).Error; err != nil {
+		return hasil, err
+	}
+	for i := range jeda {
+		hasil[jeda[i].KdRuangPoli] = &jeda[i]
+	}
+	return hasil, nil
+}
+
+// pastikanRuangAktif mengembalikan errRuangDijeda beserta alasannya jika ruang poli sedang dijeda.
+// Dipanggil di dalam transaksi setelah kunciRuangPoli.
+func pastikanRuangAktif(tx *gorm.DB, kdRuangPoli string) error {
+	jeda, err := cariJedaRuangPoli(tx, kdRuangPoli)
+	if err != nil {
+		return err
+	}
+	if jeda != nil {
+		return fmt.Errorf("%w: %s", errRuangDijeda, jeda.Alasan)
+	}
+	return nil
+}
+
+// parsePerkiraanKembali mengubah jam perkiraan kembali (format HH:MM) menjadi waktu hari ini
+func parsePerkiraanKembali(jam string) (*time.Time, error) {
+	if jam == "" {
+		return nil, nil
+	}
+
+	t, err := time.ParseInLocation("15:04", jam, time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	hariIni := awalHariIni()
+	kembali := time.Date(hariIni.Year(), hariIni.Month(), hariIni.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+	return &kembali, nil
+}
+
+// JedaRuangPoli menjeda antrian ruang poli dengan alasan dan perkiraan waktu kembali.
+// Selama dijeda, ruang poli tidak dapat memanggil pasien dan display menampilkan alasannya.
+func (h *JedaRuangPoliHandler) JedaRuangPoli(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	var input struct {
+		Alasan           string `json:"alasan" binding:"required"`
+		PerkiraanKembali string `json:"perkiraan_kembali"` // Format HH:MM
+		Petugas          string `json:"petugas"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Alasan jeda harus diisi",
+		})
+		return
+	}
+
+	perkiraanKembali, err := parsePerkiraanKembali(input.PerkiraanKembali)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Perkiraan kembali harus dalam format HH:MM",
+		})
+		return
+	}
+
+	jeda := models.JedaRuangPoli{
+		KdRuangPoli:      kdRuangPoli,
+		Alasan:           input.Alasan,
+		PerkiraanKembali: perkiraanKembali,
+		Petugas:          input.Petugas,
+		WaktuMulai:       time.Now(),
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := kunciRuangPoli(tx, kdRuangPoli); err != nil {
+			return err
+		}
+
+		// Jeda ulang saat masih dijeda memperbarui alasan dan perkiraan kembali
+		if lama, err := cariJedaRuangPoli(tx, kdRuangPoli); err != nil {
+			return err
+		} else if lama != nil {
+			jeda.WaktuMulai = lama.WaktuMulai
+		}
+
+		if err := tx.Save(&jeda).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RiwayatJedaRuangPoli{
+			KdRuangPoli:      kdRuangPoli,
+			Aksi:             models.AksiJedaRuangPoli,
+			Alasan:           jeda.Alasan,
+			PerkiraanKembali: jeda.PerkiraanKembali,
+			Petugas:          jeda.Petugas,
+			Waktu:            time.Now(),
+		}).Error
+	})
+
+	if errors.Is(err, errRuangTidakDitemukan) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Ruang poli tidak ditemukan",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal menjeda antrian: " + err.Error(),
+		})
+		return
+	}
+	h.Snapshot.TandaiBerubah(kdRuangPoli)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    jeda,
+		"message": "Antrian ruang poli berhasil dijeda",
+	})
+}
+
+// LanjutRuangPoli melanjutkan antrian ruang poli yang sedang dijeda
+func (h *JedaRuangPoliHandler) LanjutRuangPoli(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	var input struct {
+		Petugas string `json:"petugas"`
+	}
+	// Body bersifat opsional
+	_ = c.ShouldBindJSON(&input)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := kunciRuangPoli(tx, kdRuangPoli); err != nil {
+			return err
+		}
+
+		jeda, err := cariJedaRuangPoli(tx, kdRuangPoli)
+		if err != nil {
+			return err
+		}
+		if jeda == nil {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Delete(jeda).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RiwayatJedaRuangPoli{
+			KdRuangPoli: kdRuangPoli,
+			Aksi:        models.AksiLanjutRuangPoli,
+			Alasan:      jeda.Alasan,
+			Petugas:     input.Petugas,
+			Waktu:       time.Now(),
+		}).Error
+	})
+
+	if errors.Is(err, errRuangTidakDitemukan) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Ruang poli tidak ditemukan",
+		})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Antrian ruang poli tidak sedang dijeda",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal melanjutkan antrian: " + err.Error(),
+		})
+		return
+	}
+	h.Snapshot.TandaiBerubah(kdRuangPoli)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"kd_ruang_poli": kdRuangPoli,
+		},
+		"message": "Antrian ruang poli berhasil dilanjutkan",
+	})
+}
+
+// GetJedaRuangPoli mengembalikan status jeda ruang poli dan riwayat jeda hari ini
+func (h *JedaRuangPoliHandler) GetJedaRuangPoli(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	jeda, err := cariJedaRuangPoli(h.DB, kdRuangPoli)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengambil status jeda: " + err.Error(),
+		})
+		return
+	}
+
+	riwayat := []models.RiwayatJedaRuangPoli{}
+	h.DB.Where("kd_ruang_poli = ? AND waktu >= ?", kdRuangPoli, awalHariIni()).
+		Order("waktu asc").
+		Find(&riwayat)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"dijeda":  jeda != nil,
+			"jeda":    jeda,
+			"riwayat": riwayat,
+		},
+	})
+}
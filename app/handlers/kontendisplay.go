@@ -0,0 +1,591 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// direktoriMedia adalah lokasi penyimpanan file media yang diunggah
+const direktoriMedia = "assets/media"
+
+// maksUkuranMedia adalah ukuran maksimal file media yang boleh diunggah (200 MB)
+const maksUkuranMedia = 200 << 20
+
+// ekstensiMedia memetakan ekstensi file yang diizinkan ke jenis media
+var ekstensiMedia = map[string]string{
+	".jpg":  models.MediaGambar,
+	".jpeg": models.MediaGambar,
+	".png":  models.MediaGambar,
+	".gif":  models.MediaGambar,
+	".webp": models.MediaGambar,
+	".mp4":  models.MediaVideo,
+	".webm": models.MediaVideo,
+}
+
+// formatWaktuTayang adalah format waktu mulai dan selesai tayang pada input API
+const formatWaktuTayang = "2006-01-02 15:04"
+
+// KontenDisplayHandler menangani media playlist dan running text untuk display
+type KontenDisplayHandler struct {
+	DB     *gorm.DB
+	Socket *DisplaySocketHub
+
+	mu           sync.Mutex
+	hashTerkirim map[string]string // Hash konten terakhir yang dikirim per display
+}
+
+// NewKontenDisplayHandler membuat instance baru dari KontenDisplayHandler
+func NewKontenDisplayHandler(db *gorm.DB) *KontenDisplayHandler {
+	return &KontenDisplayHandler{
+		DB:           db,
+		hashTerkirim: make(map[string]string),
+	}
+}
+
+// SetSocketHub menetapkan hub WebSocket display dan mendaftarkan pengiriman konten saat display terhubung
+func (h *KontenDisplayHandler) SetSocketHub(socket *DisplaySocketHub) {
+	h.Socket = socket
+	socket.TambahPesanAwal(h.pesanKontenDisplay)
+}
+
+// kontenDisplay adalah konten yang sedang tayang pada sebuah display
+type kontenDisplay struct {
+	Playlist    []models.PlaylistDisplay `json:"playlist"`
+	RunningText []models.RunningText     `json:"running_text"`
+}
+
+// sedangTayang membatasi query pada konten yang berada di dalam jendela tayangnya
+func sedangTayang(db *gorm.DB, sekarang time.Time) *gorm.DB {
+	return db.Where("(mulai_tayang IS NULL OR mulai_tayang <= ?) AND (selesai_tayang IS NULL OR selesai_tayang > ?)", sekarang, sekarang)
+}
+
+// getKontenDisplay mengambil playlist dan running text yang sedang tayang pada display
+func (h *KontenDisplayHandler) getKontenDisplay(kdDisplay string) (kontenDisplay, error) {
+	sekarang := time.Now()
+	konten := kontenDisplay{
+		Playlist:    []models.PlaylistDisplay{},
+		RunningText: []models.RunningText{},
+	}
+
+	err := sedangTayang(h.DB, sekarang).
+		Preload("Media").
+		Where("kd_display = ?", kdDisplay).
+		Order("urutan asc").
+		Order("id asc").
+		Find(&konten.Playlist).Error
+	if err != nil {
+		return konten, err
+	}
+
+	err = sedangTayang(h.DB, sekarang).
+		Where("kd_display = ?", kdDisplay).
+		Order("urutan asc").
+		Order("id asc").
+		Find(&konten.RunningText).Error
+	return konten, err
+}
+
+// pesanKontenDisplay membuat pesan WebSocket berisi konten yang sedang tayang pada display
+func (h *KontenDisplayHandler) pesanKontenDisplay(kdDisplay string) interface{} {
+	konten, err := h.getKontenDisplay(kdDisplay)
+	if err != nil {
+		log.Printf("Gagal mengambil konten display %s: %v", kdDisplay, err)
+		return nil
+	}
+
+	return pesanDisplay{
+		Type:      "konten",
+		KdDisplay: kdDisplay,
+		Data:      konten,
+	}
+}
+
+// kirimKonten mengirim konten terbaru ke display jika berbeda dari yang terakhir dikirim.
+// paksa mengirim konten walaupun sama, dipakai setelah konten diubah melalui API.
+func (h *KontenDisplayHandler) kirimKonten(kdDisplay string, paksa bool) {
+	pesan := h.pesanKontenDisplay(kdDisplay)
+	if pesan == nil {
+		return
+	}
+
+	body, _ := json.Marshal(pesan)
+	hash := sha256.Sum256(body)
+	hashKonten := hex.EncodeToString(hash[:])
+
+	h.mu.Lock()
+	sama := h.hashTerkirim[kdDisplay] == hashKonten
+	h.hashTerkirim[kdDisplay] = hashKonten
+	h.mu.Unlock()
+
+	if sama && !paksa {
+		return
+	}
+	h.Socket.KirimKeDisplay(kdDisplay, pesan)
+}
+
+// MulaiPenjadwalanKonten memeriksa secara berkala konten yang mulai atau selesai tayang
+// dan mengirim perubahan ke display yang terhubung
+func (h *KontenDisplayHandler) MulaiPenjadwalanKonten(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, kdDisplay := range h.Socket.DisplayTerhubung() {
+			h.kirimKonten(kdDisplay, false)
+		}
+	}
+}
+
+// parseWaktuTayang mengubah input waktu tayang (YYYY-MM-DD HH:MM) menjadi waktu, nil jika kosong
+func parseWaktuTayang(waktu string) (*time.Time, error) {
+	if waktu == "" {
+		return nil, nil
+	}
+
+	t, err := time.ParseInLocation(formatWaktuTayang, waktu, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseJendelaTayang mengubah input mulai dan selesai tayang serta memastikan mulai sebelum selesai
+func parseJendelaTayang(mulai, selesai string) (*time.Time, *time.Time, error) {
+	mulaiTayang, err := parseWaktuTayang(mulai)
+	if err != nil {
+		return nil, nil, err
+	}
+	selesaiTayang, err := parseWaktuTayang(selesai)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mulaiTayang != nil && selesaiTayang != nil && !mulaiTayang.Before(*selesaiTayang) {
+		return nil, nil, errors.New("mulai tayang harus sebelum selesai tayang")
+	}
+	return mulaiTayang, selesaiTayang, nil
+}
+
+// GetAllMedia mengembalikan daftar semua media dalam format JSON
+func (h *KontenDisplayHandler) GetAllMedia(c *gin.Context) {
+	media := []models.Media{}
+	h.DB.Order("dibuat desc").Find(&media)
+	c.JSON(http.StatusOK, media)
+}
+
+// UploadMedia mengunggah file gambar atau video ke assets/media
+func (h *KontenDisplayHandler) UploadMedia(c *gin.Context) {
+	// Batasi body sebelum form dibaca agar unggahan yang terlalu besar tidak ditulis ke disk sementara.
+	// Tambahan 1 MB untuk header multipart.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maksUkuranMedia+1<<20)
+
+	file, err := c.FormFile("file")
+	var terlaluBesar *http.MaxBytesError
+	if errors.As(err, &terlaluBesar) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"message": "Ukuran file maksimal 200 MB",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "File media harus diunggah",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	ekstensi := strings.ToLower(filepath.Ext(file.Filename))
+	jenis, ok := ekstensiMedia[ekstensi]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Format file harus jpg, jpeg, png, gif, webp, mp4, atau webm",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if file.Size > maksUkuranMedia {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Ukuran file maksimal 200 MB",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if err := os.MkdirAll(direktoriMedia, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyiapkan direktori media",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	// Nama file acak agar tidak menimpa file lain
+	acak := make([]byte, 16)
+	if _, err := rand.Read(acak); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan media",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	filename := hex.EncodeToString(acak) + ekstensi
+
+	if err := c.SaveUploadedFile(file, filepath.Join(direktoriMedia, filename)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan media",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	judul := c.PostForm("judul")
+	if judul == "" {
+		judul = strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename))
+	}
+
+	media := models.Media{
+		Judul:  judul,
+		Jenis:  jenis,
+		File:   "/" + direktoriMedia + "/" + filename,
+		Ukuran: file.Size,
+		Dibuat: time.Now(),
+	}
+	if err := h.DB.Create(&media).Error; err != nil {
+		os.Remove(filepath.Join(direktoriMedia, filename))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan media",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Media berhasil diunggah!",
+		"color":   "success",
+		"icon":    "check",
+		"data":    media,
+	})
+}
+
+// DeleteMedia menghapus media beserta filenya dan mengeluarkannya dari semua playlist
+func (h *KontenDisplayHandler) DeleteMedia(c *gin.Context) {
+	var media models.Media
+	if err := h.DB.Where("id = ?", c.Param("id")).First(&media).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Media tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	var kdDisplay []string
+	h.DB.Model(&models.PlaylistDisplay{}).Where("id_media = ?", media.ID).Distinct().Pluck("kd_display", &kdDisplay)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_media = ?", media.ID).Delete(&models.PlaylistDisplay{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&media).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menghapus media",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	filePath := strings.TrimPrefix(media.File, "/")
+	if err := os.Remove(filePath); err != nil {
+		log.Printf("Error removing media file %s: %v", filePath, err)
+	}
+
+	for _, kd := range kdDisplay {
+		h.kirimKonten(kd, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Media berhasil dihapus!",
+		"color":   "warning",
+		"icon":    "check",
+	})
+}
+
+// inputPlaylist adalah input untuk menambah atau mengubah item playlist
+type inputPlaylist struct {
+	IDMedia       uint   `json:"id_media" binding:"required"`
+	Urutan        int    `json:"urutan"`
+	Durasi        int    `json:"durasi"`
+	MulaiTayang   string `json:"mulai_tayang"`   // Format YYYY-MM-DD HH:MM
+	SelesaiTayang string `json:"selesai_tayang"` // Format YYYY-MM-DD HH:MM
+}
+
+// GetPlaylist mengembalikan semua item playlist display, termasuk yang di luar jendela tayang
+func (h *KontenDisplayHandler) GetPlaylist(c *gin.Context) {
+	playlist := []models.PlaylistDisplay{}
+	h.DB.Preload("Media").
+		Where("kd_display = ?", c.Param("kd_display")).
+		Order("urutan asc").
+		Order("id asc").
+		Find(&playlist)
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// TambahPlaylist menambahkan media ke playlist display
+func (h *KontenDisplayHandler) TambahPlaylist(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	var jumlah int64
+	h.DB.Table("bw_display_poli").Where("kd_display = ?", kdDisplay).Count(&jumlah)
+	if jumlah == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Display tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.simpanPlaylist(c, models.PlaylistDisplay{KdDisplay: kdDisplay})
+}
+
+// UbahPlaylist mengubah item playlist display
+func (h *KontenDisplayHandler) UbahPlaylist(c *gin.Context) {
+	var item models.PlaylistDisplay
+	err := h.DB.Where("id = ? AND kd_display = ?", c.Param("id"), c.Param("kd_display")).First(&item).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Item playlist tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.simpanPlaylist(c, item)
+}
+
+// simpanPlaylist memvalidasi input lalu menyimpan item playlist
+func (h *KontenDisplayHandler) simpanPlaylist(c *gin.Context, item models.PlaylistDisplay) {
+	var input inputPlaylist
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Media harus dipilih",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	var media models.Media
+	if err := h.DB.Where("id = ?", input.IDMedia).First(&media).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Media tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if media.Jenis == models.MediaGambar && input.Durasi < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Durasi tayang gambar minimal 1 detik",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	mulaiTayang, selesaiTayang, err := parseJendelaTayang(input.MulaiTayang, input.SelesaiTayang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jadwal tayang tidak valid, gunakan format YYYY-MM-DD HH:MM dengan mulai sebelum selesai",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	item.IDMedia = input.IDMedia
+	item.Urutan = input.Urutan
+	item.Durasi = input.Durasi
+	item.MulaiTayang = mulaiTayang
+	item.SelesaiTayang = selesaiTayang
+	item.Media = models.Media{}
+
+	if err := h.DB.Omit("Media").Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan playlist",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.kirimKonten(item.KdDisplay, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Playlist berhasil disimpan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// HapusPlaylist menghapus item playlist display
+func (h *KontenDisplayHandler) HapusPlaylist(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	result := h.DB.Where("id = ? AND kd_display = ?", c.Param("id"), kdDisplay).Delete(&models.PlaylistDisplay{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menghapus item playlist",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.kirimKonten(kdDisplay, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Item playlist berhasil dihapus!",
+		"color":   "warning",
+		"icon":    "check",
+	})
+}
+
+// inputRunningText adalah input untuk menambah atau mengubah running text
+type inputRunningText struct {
+	Teks          string `json:"teks" binding:"required"`
+	Urutan        int    `json:"urutan"`
+	MulaiTayang   string `json:"mulai_tayang"`   // Format YYYY-MM-DD HH:MM
+	SelesaiTayang string `json:"selesai_tayang"` // Format YYYY-MM-DD HH:MM
+}
+
+// GetRunningText mengembalikan semua running text display, termasuk yang di luar jendela tayang
+func (h *KontenDisplayHandler) GetRunningText(c *gin.Context) {
+	runningText := []models.RunningText{}
+	h.DB.Where("kd_display = ?", c.Param("kd_display")).
+		Order("urutan asc").
+		Order("id asc").
+		Find(&runningText)
+
+	c.JSON(http.StatusOK, runningText)
+}
+
+// TambahRunningText menambahkan running text ke display
+func (h *KontenDisplayHandler) TambahRunningText(c *gin.Context) {
+	h.simpanRunningText(c, models.RunningText{KdDisplay: c.Param("kd_display")})
+}
+
+// UbahRunningText mengubah running text display
+func (h *KontenDisplayHandler) UbahRunningText(c *gin.Context) {
+	var runningText models.RunningText
+	err := h.DB.Where("id = ? AND kd_display = ?", c.Param("id"), c.Param("kd_display")).First(&runningText).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Running text tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.simpanRunningText(c, runningText)
+}
+
+// simpanRunningText memvalidasi input lalu menyimpan running text
+func (h *KontenDisplayHandler) simpanRunningText(c *gin.Context, runningText models.RunningText) {
+	var input inputRunningText
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Teks harus diisi",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	mulaiTayang, selesaiTayang, err := parseJendelaTayang(input.MulaiTayang, input.SelesaiTayang)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jadwal tayang tidak valid, gunakan format YYYY-MM-DD HH:MM dengan mulai sebelum selesai",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	runningText.Teks = input.Teks
+	runningText.Urutan = input.Urutan
+	runningText.MulaiTayang = mulaiTayang
+	runningText.SelesaiTayang = selesaiTayang
+
+	if err := h.DB.Save(&runningText).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan running text",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.kirimKonten(runningText.KdDisplay, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Running text berhasil disimpan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// HapusRunningText menghapus running text display
+func (h *KontenDisplayHandler) HapusRunningText(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	result := h.DB.Where("id = ? AND kd_display = ?", c.Param("id"), kdDisplay).Delete(&models.RunningText{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menghapus running text",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.kirimKonten(kdDisplay, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Running text berhasil dihapus!",
+		"color":   "warning",
+		"icon":    "check",
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// kolomNomorAntrian adalah kolom select nomor antrian rumah sakit. Pasien yang belum mendapat
+// nomor memakai no_reg Khanza. Query harus memuat LEFT JOIN bw_nomor_antrian dari queryAntrian.
+const kolomNomorAntrian = "COALESCE(bw_nomor_antrian.kode_antrian, reg_periksa.no_reg) AS no_antrian"
+
+// formatNomorAntrian menyusun kode nomor antrian dari prefix ruang poli, misalnya A-012
+func formatNomorAntrian(prefix string, nomor int) string {
+	if prefix == "" {
+		return fmt.Sprintf("%03d", nomor)
+	}
+	return fmt.Sprintf("%s-%03d", prefix, nomor)
+}
+
+// ejaanNomorAntrian mengubah kode nomor antrian menjadi teks yang dibacakan TTS,
+// misalnya A-012 menjadi "A 12"
+func ejaanNomorAntrian(kode string) string {
+	bagian := strings.Split(kode, "-")
+	nomor := strings.TrimLeft(bagian[len(bagian)-1], "0")
+	if nomor == "" {
+		nomor = "0"
+	}
+	bagian[len(bagian)-1] = nomor
+	return strings.Join(bagian, " ")
+}
+
+// nomoriAntrian memberikan nomor antrian kepada pasien hari ini pada ruang poli tertentu yang belum
+// memilikinya, berurutan sesuai jam registrasi. Beberapa ruang poli diperiksa dalam satu query.
+// Pasien diproses per ruang poli secara berurutan sehingga penghitung selalu dikunci dengan urutan yang sama.
+// Mengembalikan ruang poli yang pasiennya baru mendapat nomor.
+func nomoriAntrian(db *gorm.DB, kdRuangPoli ...string) ([]string, error) {
+	if len(kdRuangPoli) == 0 {
+		return nil, nil
+	}
+
+	var belum []map[string]interface{}
+	err := queryAntrianRuang(db, kdRuangPoli).
+		Select("reg_periksa.no_rawat, " + kolomRuangPoli).
+		Where("bw_nomor_antrian.no_rawat IS NULL").
+		Order("kd_ruang_poli asc").
+		Order("reg_periksa.jam_reg asc").
+		Order("reg_periksa.no_reg asc").
+		Find(&belum).Error
+	if err != nil || len(belum) == 0 {
+		return nil, err
+	}
+
+	var ruangPoli []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, pasien := range belum {
+			kd := fmt.Sprint(pasien["kd_ruang_poli"])
+			if _, err := buatNomorAntrian(tx, fmt.Sprint(pasien["no_rawat"]), kd); err != nil {
+				return err
+			}
+			if len(ruangPoli) == 0 || ruangPoli[len(ruangPoli)-1] != kd {
+				ruangPoli = append(ruangPoli, kd)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ruangPoli, nil
+}
+
+// buatNomorAntrian mengembalikan nomor antrian pasien, atau memberikan nomor berikutnya pada ruang poli
+// jika pasien belum memilikinya. Penghitung dikunci per ruang poli per hari sehingga nomor tidak
+// pernah ganda dan mulai dari 1 setiap hari. Harus dipanggil di dalam transaksi.
+func buatNomorAntrian(tx *gorm.DB, noRawat, kdRuangPoli string) (models.NomorAntrian, error) {
+	tanggal := awalHariIni()
+
+	// Pastikan penghitung hari ini ada lalu kunci barisnya
+	err := tx.Exec(`
+		INSERT INTO bw_counter_antrian (kd_ruang_poli, tanggal, terakhir)
+		VALUES (?, ?, 0)
+		ON DUPLICATE KEY UPDATE terakhir = terakhir
+	`, kdRuangPoli, tanggal).Error
+	if err != nil {
+		return models.NomorAntrian{}, err
+	}
+
+	var counter models.CounterAntrian
+	err = tx.Where("kd_ruang_poli = ? AND tanggal = ?", kdRuangPoli, tanggal).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&counter).Error
+	if err != nil {
+		return models.NomorAntrian{}, err
+	}
+
+	// Pasien mungkin sudah mendapat nomor dari permintaan lain selama menunggu kunci
+	var ada []models.NomorAntrian
+	if err := tx.Where("no_rawat = ?", noRawat).Limit(1).Find(&ada).Error; err != nil {
+		return models.NomorAntrian{}, err
+	}
+	if len(ada) > 0 {
+		return ada[0], nil
+	}
+
+	var prefix string
+	err = tx.Table("bw_ruang_poli").
+		Select("COALESCE(prefix_antrian, '')").
+		Where("kd_ruang_poli = ?", kdRuangPoli).
+		Row().
+		Scan(&prefix)
+	if err != nil {
+		return models.NomorAntrian{}, err
+	}
+
+	counter.Terakhir++
+	err = tx.Model(&models.CounterAntrian{}).
+		Where("kd_ruang_poli = ? AND tanggal = ?", kdRuangPoli, tanggal).
+		Update("terakhir", counter.Terakhir).Error
+	if err != nil {
+		return models.NomorAntrian{}, err
+	}
+
+	nomor := models.NomorAntrian{
+		NoRawat:     noRawat,
+		KdRuangPoli: kdRuangPoli,
+		Tanggal:     tanggal,
+		Nomor:       counter.Terakhir,
+		KodeAntrian: formatNomorAntrian(prefix, counter.Terakhir),
+	}
+	return nomor, tx.Create(&nomor).Error
+}
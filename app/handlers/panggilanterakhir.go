@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// jumlahPanggilanTerakhir adalah jumlah default panggilan terakhir yang dikirim ke display
+const jumlahPanggilanTerakhir = 10
+
+// maksPanggilanTerakhir adalah jumlah maksimal panggilan terakhir yang dapat diminta
+const maksPanggilanTerakhir = 50
+
+// panggilanTerakhir mengambil panggilan hari ini pada ruang poli yang tampil di display, terbaru lebih dulu.
+// Panggilan yang ditahan karena display sedang standby tidak ikut ditampilkan.
+// Nama pasien disamarkan sesuai kebijakan display dan ruang poli seperti pada snapshot display.
+func panggilanTerakhir(db *gorm.DB, kdDisplay string, jumlah int) ([]map[string]interface{}, error) {
+	var riwayat []map[string]interface{}
+	err := db.Table("bw_riwayat_panggilan").
+		Select("bw_riwayat_panggilan.kd_ruang_poli, bw_riwayat_panggilan.nm_poli, bw_riwayat_panggilan.no_reg, "+
+			"bw_riwayat_panggilan.no_antrian, bw_riwayat_panggilan.nm_pasien, bw_riwayat_panggilan.panggilan_ke, "+
+			"bw_riwayat_panggilan.waktu_panggil").
+		Joins("JOIN bw_display_ruang_poli ON bw_riwayat_panggilan.kd_ruang_poli = bw_display_ruang_poli.kd_ruang_poli").
+		Where("bw_display_ruang_poli.kd_display = ? AND bw_riwayat_panggilan.waktu_panggil >= ?", kdDisplay, awalHariIni()).
+		Where(diLuarStandby(db, kdDisplay)).
+		Order("bw_riwayat_panggilan.waktu_panggil desc").
+		Order("bw_riwayat_panggilan.id desc").
+		Limit(jumlah).
+		Find(&riwayat).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hasil := make([]map[string]interface{}, 0, len(riwayat))
+	if len(riwayat) == 0 {
+		return hasil, nil
+	}
+
+	var kdRuangPoliList []string
+	adaRuang := make(map[string]bool)
+	for _, r := range riwayat {
+		if kd := stringValue(r["kd_ruang_poli"]); !adaRuang[kd] {
+			adaRuang[kd] = true
+			kdRuangPoliList = append(kdRuangPoliList, kd)
+		}
+	}
+
+	pengaturan, err := getPengaturanRuangPoliList(db, kdRuangPoliList)
+	if err != nil {
+		return nil, err
+	}
+	samaran, err := samaranDisplay(db, []string{kdDisplay})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range riwayat {
+		kdRuangPoli := stringValue(r["kd_ruang_poli"])
+		kebijakan := samaranLebihKetat(samaran[kdDisplay], pengaturan[kdRuangPoli].SamaranNama)
+
+		noAntrian := stringValue(r["no_antrian"])
+		if noAntrian == "" {
+			noAntrian = stringValue(r["no_reg"])
+		}
+
+		waktu := ""
+		if t, ok := r["waktu_panggil"].(time.Time); ok {
+			waktu = t.Format("15:04")
+		}
+
+		hasil = append(hasil, map[string]interface{}{
+			"kd_ruang_poli": kdRuangPoli,
+			"nm_poli":       r["nm_poli"],
+			"no_antrian":    noAntrian,
+			"nm_pasien":     samarkanNama(stringValue(r["nm_pasien"]), kebijakan),
+			"panggilan_ke":  toInt(r["panggilan_ke"]),
+			"waktu_panggil": waktu,
+		})
+	}
+	return hasil, nil
+}
+
+// diLuarStandby membangun kondisi riwayat panggilan hari ini yang terjadi dalam jam operasi display,
+// sama dengan hitungStatusOperasi. Display tanpa jadwal operasi selalu menyala.
+func diLuarStandby(db *gorm.DB, kdDisplay string) *gorm.DB {
+	hari := services.GetDayList()[time.Now().Format("Monday")]
+	sesi := db.Session(&gorm.Session{NewDB: true})
+
+	return sesi.Where("NOT EXISTS (?)",
+		sesi.Table("bw_jadwal_operasi_display").Select("1").Where("kd_display = ?", kdDisplay)).
+		Or("EXISTS (?)", sesi.Table("bw_jadwal_operasi_display").Select("1").
+			Where("kd_display = ? AND hari_kerja = ?", kdDisplay, hari).
+			Where("DATE_FORMAT(bw_riwayat_panggilan.waktu_panggil, '%H:%i') >= jam_buka").
+			Where("DATE_FORMAT(bw_riwayat_panggilan.waktu_panggil, '%H:%i') < jam_tutup"))
+}
+
+// pesanPanggilanTerakhir membuat pesan WebSocket berisi panggilan terakhir pada display
+func pesanPanggilanTerakhir(db *gorm.DB, kdDisplay string) interface{} {
+	panggilan, err := panggilanTerakhir(db, kdDisplay, jumlahPanggilanTerakhir)
+	if err != nil {
+		log.Printf("Gagal mengambil panggilan terakhir display %s: %v", kdDisplay, err)
+		return nil
+	}
+
+	return pesanDisplay{
+		Type:      "panggilan_terakhir",
+		KdDisplay: kdDisplay,
+		Data:      panggilan,
+	}
+}
+
+// GetPanggilanTerakhir mengembalikan panggilan terakhir hari ini pada display.
+// Jumlah panggilan dapat diatur dengan query jumlah (default 10, maksimal 50).
+func (h *DisplayPoliHandler) GetPanggilanTerakhir(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	jumlah := jumlahPanggilanTerakhir
+	if q := c.Query("jumlah"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 1 || n > maksPanggilanTerakhir {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Jumlah harus antara 1 dan " + strconv.Itoa(maksPanggilanTerakhir),
+			})
+			return
+		}
+		jumlah = n
+	}
+
+	panggilan, err := panggilanTerakhir(h.DB, kdDisplay, jumlah)
+	if err != nil {
+		log.Printf("Gagal mengambil panggilan terakhir display %s: %v", kdDisplay, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"data":    nil,
+			"message": "Gagal mengambil panggilan terakhir, silakan coba lagi",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   panggilan,
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetPanggilanTerakhir(t *testing.T) {
+	errDB := errors.New("Error 1146: Table 'sik.bw_riwayat_panggilan' doesn't exist")
+
+	tests := []struct {
+		name   string
+		path   string
+		hasil  []hasilPalsu
+		status int
+	}{
+		{name: "berhasil", path: "/api/display/panggilan/D1", status: http.StatusOK},
+		{name: "jumlah tidak valid", path: "/api/display/panggilan/D1?jumlah=100", status: http.StatusBadRequest},
+		{
+			name:   "database gagal",
+			path:   "/api/display/panggilan/D1",
+			hasil:  []hasilPalsu{{memuat: "bw_riwayat_panggilan", galat: errDB}},
+			status: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := bukaDatabasePalsu(t, tt.hasil...)
+			h := &DisplayPoliHandler{DB: db}
+
+			r := gin.New()
+			r.GET("/api/display/panggilan/:kd_display", h.GetPanggilanTerakhir)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d", w.Code, tt.status)
+			}
+			if strings.Contains(w.Body.String(), "bw_riwayat_panggilan") {
+				t.Fatalf("response memuat error database: %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -15,13 +17,15 @@ import (
 	htgotts "github.com/hegedustibor/htgo-tts"
 	"gorm.io/gorm"
 
-	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
 )
 
 // PanggilPoliHandler menangani tampilan memanggil pasien di poli
 type PanggilPoliHandler struct {
 	DB          *gorm.DB
 	Broadcaster chan<- PanggilPoliMessage // Channel untuk broadcast pesan
+	Snapshot    *DisplaySnapshotCache     // Snapshot display yang ditandai berubah setiap ada kejadian antrian
+	Socket      *DisplaySocketHub         // Hub untuk mengirim panggilan terakhir ke display
 }
 
 // NewPanggilPoliHandler membuat instance baru dari PanggilPoliHandler
@@ -34,6 +38,16 @@ func (h *PanggilPoliHandler) SetBroadcaster(broadcaster chan<- PanggilPoliMessag
 	h.Broadcaster = broadcaster
 }
 
+// SetSnapshotCache menetapkan cache snapshot display untuk handler ini
+func (h *PanggilPoliHandler) SetSnapshotCache(snapshot *DisplaySnapshotCache) {
+	h.Snapshot = snapshot
+}
+
+// SetSocketHub menetapkan hub WebSocket display untuk handler ini
+func (h *PanggilPoliHandler) SetSocketHub(socket *DisplaySocketHub) {
+	h.Socket = socket
+}
+
 // HandlePanggil menampilkan halaman panggil poli
 func (h *PanggilPoliHandler) HandlePanggil(c *gin.Context) {
 	kdRuangPoli := c.Param("kd_ruang_poli")
@@ -78,6 +92,15 @@ func (h *PanggilPoliHandler) HandleLog(c *gin.Context) {
 		return
 	}
 
+	// Terapkan kebijakan pengembalian untuk pasien yang tidak hadir
+	if status == "1" {
+		if _, err := terapkanKebijakanTerlewat(h.DB, input.NoRawat, input.KdRuangPoli); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	h.Snapshot.TandaiBerubah(input.KdRuangPoli)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Status pasien berhasil diperbarui"})
 }
 
@@ -85,16 +108,27 @@ func (h *PanggilPoliHandler) HandleLog(c *gin.Context) {
 func (h *PanggilPoliHandler) ResetLog(c *gin.Context) {
 	noRawat := c.Param("no_rawat")
 
-	result := h.DB.Table("bw_log_antrian_poli").Where("no_rawat = ?", noRawat).Delete(nil)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	if err := h.hapusLogAntrian(noRawat); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Reset log berhasil"})
 }
 
+// hapusLogAntrian menghapus log antrian pasien dan menandai snapshot ruang polinya berubah
+func (h *PanggilPoliHandler) hapusLogAntrian(noRawat string) error {
+	var kdRuangPoli []string
+	h.DB.Table("bw_log_antrian_poli").Where("no_rawat = ?", noRawat).Pluck("kd_ruang_poli", &kdRuangPoli)
+
+	if err := h.DB.Table("bw_log_antrian_poli").Where("no_rawat = ?", noRawat).Delete(nil).Error; err != nil {
+		return err
+	}
+
+	h.Snapshot.TandaiBerubah(kdRuangPoli...)
+	return nil
+}
+
 // generateTTS menghasilkan file audio dari teks dan mengembalikan URL relatif
 func (h *PanggilPoliHandler) generateTTS(text, kdRuangPoli, noReg string) (string, error) {
 	// Buat hash dari teks untuk nama file unik
@@ -132,6 +166,163 @@ func (h *PanggilPoliHandler) generateTTS(text, kdRuangPoli, noReg string) (strin
 	return "/assets/temp_audio/" + filename, nil
 }
 
+// kirimPanggilan mencatat panggilan pasien dalam satu transaksi lalu mengumumkannya ke display.
+// Tanpa noRawat, panggilan hanya dicatat pada riwayat (panggilan_ke 0) tanpa mengubah status antrian.
+func (h *PanggilPoliHandler) kirimPanggilan(msg PanggilPoliMessage, noRawat string) (PanggilPoliMessage, error) {
+	if noRawat == "" {
+		err := h.DB.Create(&models.RiwayatPanggilan{
+			KdRuangPoli:  msg.KdRuangPoli,
+			KdDisplay:    msg.KdDisplay,
+			NoReg:        msg.NoReg,
+			NoAntrian:    msg.NoAntrian,
+			NmPasien:     msg.NmPasien,
+			NmPoli:       msg.NmPoli,
+			WaktuPanggil: time.Now(),
+		}).Error
+		if err != nil {
+			return msg, err
+		}
+	} else {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := kunciRuangPoli(tx, msg.KdRuangPoli); err != nil {
+				return err
+			}
+			return catatPanggilan(tx, &msg, noRawat)
+		})
+		if err != nil {
+			return msg, err
+		}
+	}
+
+	return h.umumkanPanggilan(msg), nil
+}
+
+// umumkanPanggilan membuat audio TTS dan mengirim pesan ke broadcaster untuk setiap display
+// yang menampilkan ruang poli dan tidak sedang standby. Nama pasien dan teks TTS disamarkan sesuai kebijakan masing-masing
+// display; pesan yang dikembalikan ke konsol perawat tetap memuat nama lengkap.
+// Dipanggil setelah transaksi panggilan berhasil disimpan.
+func (h *PanggilPoliHandler) umumkanPanggilan(msg PanggilPoliMessage) PanggilPoliMessage {
+	h.Snapshot.TandaiBerubah(msg.KdRuangPoli)
+
+	kdDisplayList, err := displayUntukRuangPoli(h.DB, msg.KdRuangPoli)
+	if err != nil {
+		log.Printf("Error getting displays for poli %s: %v", msg.KdRuangPoli, err)
+	}
+	if len(kdDisplayList) == 0 && msg.KdDisplay != "" {
+		kdDisplayList = []string{msg.KdDisplay}
+	}
+
+	// Display yang sedang standby di luar jam operasinya tidak menerima panggilan
+	standby, err := displayStandby(h.DB, kdDisplayList, time.Now())
+	if err != nil {
+		log.Printf("Error getting operating schedule for poli %s: %v", msg.KdRuangPoli, err)
+	}
+	var displayAktif, displayDitahan []string
+	for _, kdDisplay := range kdDisplayList {
+		if standby[kdDisplay] {
+			displayDitahan = append(displayDitahan, kdDisplay)
+		} else {
+			displayAktif = append(displayAktif, kdDisplay)
+		}
+	}
+	kdDisplayList = displayAktif
+
+	samaranRuang := getPengaturanRuangPoli(h.DB, msg.KdRuangPoli).SamaranNama
+	samaran, err := samaranDisplay(h.DB, kdDisplayList)
+	if err != nil {
+		log.Printf("Error getting name masking for poli %s: %v", msg.KdRuangPoli, err)
+	}
+
+	// Audio TTS dibuat sekali untuk setiap kebijakan samaran yang dipakai
+	audioUrl := make(map[string]string)
+	buatAudio := func(kebijakan string) string {
+		if url, ok := audioUrl[kebijakan]; ok {
+			return url
+		}
+		url, err := h.generateTTS(teksPanggilan(msg, kebijakan), msg.KdRuangPoli, msg.NoReg)
+		if err != nil {
+			log.Printf("Error generating TTS: %v", err)
+			// Lanjutkan meskipun TTS gagal
+		}
+		audioUrl[kebijakan] = url
+		return url
+	}
+
+	for _, kdDisplay := range kdDisplayList {
+		kebijakan := samaranLebihKetat(samaran[kdDisplay], samaranRuang)
+
+		pesan := msg
+		pesan.KdDisplay = kdDisplay
+		pesan.NmPasien = samarkanNama(msg.NmPasien, kebijakan)
+		pesan.AudioUrl = buatAudio(kebijakan)
+
+		// Kirim ke broadcaster jika tersedia
+		if h.Broadcaster != nil {
+			log.Printf("Mengirim pesan panggil ke broadcaster untuk display %s", kdDisplay)
+			h.Broadcaster <- pesan
+		} else {
+			log.Printf("Broadcaster tidak tersedia, tidak bisa mengirim pesan untuk display %s", kdDisplay)
+		}
+	}
+
+	// Perbarui daftar panggilan terakhir pada setiap display
+	if h.Socket != nil {
+		for _, kdDisplay := range kdDisplayList {
+			if pesan := pesanPanggilanTerakhir(h.DB, kdDisplay); pesan != nil {
+				h.Socket.KirimKeDisplay(kdDisplay, pesan)
+			}
+		}
+	}
+
+	// Konsol perawat menerima audio dengan samaran ruang poli dan daftar display yang tidak menampilkan panggilan
+	msg.AudioUrl = buatAudio(samaranLebihKetat(samaranRuang))
+	msg.DisplayDitahan = displayDitahan
+	msg.Ditahan = len(displayDitahan) > 0 && len(displayAktif) == 0
+	return msg
+}
+
+// pesanBerhasilPanggil menambahkan keterangan pada pesan response jika panggilan ditahan
+// karena semua display ruang poli sedang standby
+func pesanBerhasilPanggil(message string, msg PanggilPoliMessage) string {
+	if msg.Ditahan {
+		return message + ", tetapi tidak ditampilkan karena display sedang standby"
+	}
+	return message
+}
+
+// statusErrorPanggilan menentukan kode HTTP untuk error dari proses panggilan
+func statusErrorPanggilan(err error) int {
+	switch {
+	case errors.Is(err, errPanggilanBentrok), errors.Is(err, errRuangDijeda):
+		return http.StatusConflict
+	case errors.Is(err, errAntrianKosong), errors.Is(err, errRuangTidakDitemukan):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// cariRuangPoli mengambil data ruang poli dan menulis response error jika tidak ditemukan
+func (h *PanggilPoliHandler) cariRuangPoli(c *gin.Context, kdRuangPoli string) (models.RuangPoli, bool) {
+	var ruangPoli models.RuangPoli
+	if err := h.DB.Where("kd_ruang_poli = ?", kdRuangPoli).First(&ruangPoli).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Ruang poli tidak ditemukan",
+			})
+			return ruangPoli, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengambil data ruang poli: " + err.Error(),
+		})
+		return ruangPoli, false
+	}
+
+	return ruangPoli, true
+}
+
 // PanggilPasien mengirim event untuk memanggil pasien
 func (h *PanggilPoliHandler) PanggilPasien(c *gin.Context) {
 	var input struct {
@@ -148,80 +339,117 @@ func (h *PanggilPoliHandler) PanggilPasien(c *gin.Context) {
 		return
 	}
 
-	// Buat teks untuk TTS
-	ttsText := fmt.Sprintf("Nomor antrian %s, atas nama %s, silakan menuju %s",
-		input.NoReg, input.NmPasien, input.NmPoli)
-
-	// Generate file audio TTS
-	audioUrl, err := h.generateTTS(ttsText, input.KdRuangPoli, input.NoReg)
-	if err != nil {
-		log.Printf("Error generating TTS: %v", err)
-		// Lanjutkan meskipun TTS gagal
-	}
-
-	// Buat pesan untuk dikirim ke websocket
-	msg := PanggilPoliMessage{
+	msg, err := h.kirimPanggilan(PanggilPoliMessage{
 		NmPasien:    input.NmPasien,
 		KdRuangPoli: input.KdRuangPoli,
 		NmPoli:      input.NmPoli,
 		NoReg:       input.NoReg,
 		KdDisplay:   input.KdDisplay,
-		AudioUrl:    audioUrl,
-	}
+	}, input.NoRawat)
 
-	// Kirim ke broadcaster jika tersedia
-	if h.Broadcaster != nil {
-		log.Printf("Mengirim pesan panggil ke broadcaster: %+v", msg)
-		h.Broadcaster <- msg
-	} else {
-		log.Printf("Broadcaster tidak tersedia, tidak bisa mengirim pesan: %+v", msg)
+	if err != nil {
+		c.JSON(statusErrorPanggilan(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	// Tambahkan: Update status pasien di bw_log_antrian_poli untuk menandai pasien yang dipanggil
-	// Status "2" menandakan pasien sedang dipanggil
-	if input.NoRawat != "" {
-		// Hapus status "sedang dipanggil" (2) dari semua pasien di poli yang sama
-		h.DB.Exec(`
-			DELETE FROM bw_log_antrian_poli 
-			WHERE kd_ruang_poli = ? AND status = '2'
-		`, input.KdRuangPoli)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": pesanBerhasilPanggil("Panggilan berhasil dikirim", msg),
+		"data":    msg,
+	})
+}
+
+// MulaiPembersihPanggilan menjalankan worker yang secara berkala memindahkan pasien dengan status
+// sedang dipanggil (2) yang sudah melewati batas_dipanggil ke daftar terlewat
+func (h *PanggilPoliHandler) MulaiPembersihPanggilan(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		// Tambahkan status baru untuk pasien yang dipanggil
-		result := h.DB.Exec(`
-			INSERT INTO bw_log_antrian_poli (no_rawat, kd_ruang_poli, status)
-			VALUES (?, ?, '2')
-			ON DUPLICATE KEY UPDATE kd_ruang_poli = ?, status = '2'
-		`, input.NoRawat, input.KdRuangPoli, input.KdRuangPoli)
+	for {
+		h.resetCallingStatus()
+		<-ticker.C
+	}
+}
 
-		if result.Error != nil {
-			log.Printf("Error updating patient status: %v", result.Error)
-		}
+// MulaiPenomoranAntrian menjalankan worker yang secara berkala memberikan nomor antrian kepada pasien
+// yang baru terdaftar di Khanza, sehingga permintaan GET display dan daftar pasien tidak pernah menulis
+// ke database. Pasien yang dipanggil sebelum worker berjalan mendapat nomor saat dipanggil.
+func (h *PanggilPoliHandler) MulaiPenomoranAntrian(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		// Jadwalkan reset status setelah 5 menit
-		go func(noRawat string) {
-			time.Sleep(5 * time.Minute)
-			h.resetCallingStatus(noRawat)
-		}(input.NoRawat)
+	for {
+		h.nomoriPendaftaranBaru()
+		<-ticker.C
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Panggilan berhasil dikirim",
-		"data":    msg,
-	})
+// nomoriPendaftaranBaru memberikan nomor antrian kepada pasien hari ini di semua ruang poli
+// dan menandai snapshot ruang poli yang pasiennya baru mendapat nomor
+func (h *PanggilPoliHandler) nomoriPendaftaranBaru() {
+	var kdRuangPoli []string
+	if err := h.DB.Table("bw_ruang_poli").Order("kd_ruang_poli asc").Pluck("kd_ruang_poli", &kdRuangPoli).Error; err != nil {
+		log.Printf("Gagal mengambil ruang poli untuk penomoran antrian: %v", err)
+		return
+	}
+
+	bernomor, err := nomoriAntrian(h.DB, kdRuangPoli...)
+	if err != nil {
+		log.Printf("Gagal memberikan nomor antrian: %v", err)
+		return
+	}
+	if len(bernomor) > 0 {
+		h.Snapshot.TandaiBerubah(bernomor...)
+	}
 }
 
-// resetCallingStatus mengembalikan status pasien dari "sedang dipanggil" (2) menjadi normal
-func (h *PanggilPoliHandler) resetCallingStatus(noRawat string) {
-	// Hapus status panggilan setelah 5 menit
-	result := h.DB.Table("bw_log_antrian_poli").
-		Where("no_rawat = ? AND status = '2'", noRawat).
-		Delete(nil)
+// resetCallingStatus memindahkan pasien yang status "sedang dipanggil" (2) sudah kedaluwarsa ke daftar
+// terlewat (1) dan menerapkan kebijakan terlewat ruang poli. Jumlah panggilan tetap disimpan agar batas
+// panggilan tetap berlaku. Setiap ruang poli diproses dalam transaksi yang mengunci ruang poli tersebut.
+func (h *PanggilPoliHandler) resetCallingStatus() {
+	now := time.Now()
+
+	var kdRuangPoli []string
+	err := h.DB.Table("bw_log_antrian_poli").
+		Where("status = '2' AND batas_dipanggil IS NOT NULL AND batas_dipanggil <= ?", now).
+		Distinct().
+		Pluck("kd_ruang_poli", &kdRuangPoli).Error
+	if err != nil {
+		log.Printf("Error resetting calling status: %v", err)
+		return
+	}
 
-	if result.Error != nil {
-		log.Printf("Error resetting calling status: %v", result.Error)
-	} else {
-		log.Printf("Successfully reset calling status for patient: %s", noRawat)
+	jumlah := 0
+	var berubah []string
+	for _, kd := range kdRuangPoli {
+		var kedaluwarsa []string
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := kunciRuangPoli(tx, kd); err != nil {
+				return err
+			}
+
+			// Periksa ulang setelah ruang poli dikunci karena pasien mungkin baru saja dipanggil ulang
+			err := tx.Table("bw_log_antrian_poli").
+				Where("kd_ruang_poli = ? AND status = '2' AND batas_dipanggil IS NOT NULL AND batas_dipanggil <= ?", kd, now).
+				Pluck("no_rawat", &kedaluwarsa).Error
+			if err != nil {
+				return err
+			}
+			return tandaiTerlewat(tx, kd, kedaluwarsa)
+		})
+		if err != nil {
+			log.Printf("Error resetting calling status for poli %s: %v", kd, err)
+			continue
+		}
+		if len(kedaluwarsa) > 0 {
+			jumlah += len(kedaluwarsa)
+			berubah = append(berubah, kd)
+		}
+	}
+
+	if jumlah > 0 {
+		log.Printf("Successfully reset %d expired calling status", jumlah)
+		h.Snapshot.TandaiBerubah(berubah...)
 	}
 }
 
@@ -244,60 +472,20 @@ func (h *PanggilPoliHandler) PanggilPasienAPI(c *gin.Context) {
 		return
 	}
 
-	// Buat teks untuk TTS
-	ttsText := fmt.Sprintf("Nomor antrian %s, atas nama %s, silakan menuju %s",
-		input.NoReg, input.NmPasien, input.NmPoli)
-
-	// Generate file audio TTS
-	audioUrl, err := h.generateTTS(ttsText, input.KdRuangPoli, input.NoReg)
-	if err != nil {
-		log.Printf("Error generating TTS: %v", err)
-		// Lanjutkan meskipun TTS gagal
-	}
-
-	// Buat pesan untuk dikirim ke websocket
-	msg := PanggilPoliMessage{
+	msg, err := h.kirimPanggilan(PanggilPoliMessage{
 		NmPasien:    input.NmPasien,
 		KdRuangPoli: input.KdRuangPoli,
 		NmPoli:      input.NmPoli,
 		NoReg:       input.NoReg,
 		KdDisplay:   input.KdDisplay,
-		AudioUrl:    audioUrl,
-	}
-
-	// Kirim ke broadcaster jika tersedia
-	if h.Broadcaster != nil {
-		log.Printf("Mengirim pesan panggil ke broadcaster: %+v", msg)
-		h.Broadcaster <- msg
-	} else {
-		log.Printf("Broadcaster tidak tersedia, tidak bisa mengirim pesan: %+v", msg)
-	}
-
-	// Tambahkan: Update status pasien di bw_log_antrian_poli untuk menandai pasien yang dipanggil
-	// Status "2" menandakan pasien sedang dipanggil
-	if input.NoRawat != "" {
-		// Hapus status "sedang dipanggil" (2) dari semua pasien di poli yang sama
-		h.DB.Exec(`
-			DELETE FROM bw_log_antrian_poli 
-			WHERE kd_ruang_poli = ? AND status = '2'
-		`, input.KdRuangPoli)
-
-		// Tambahkan status baru untuk pasien yang dipanggil
-		result := h.DB.Exec(`
-			INSERT INTO bw_log_antrian_poli (no_rawat, kd_ruang_poli, status)
-			VALUES (?, ?, '2')
-			ON DUPLICATE KEY UPDATE kd_ruang_poli = ?, status = '2'
-		`, input.NoRawat, input.KdRuangPoli, input.KdRuangPoli)
-
-		if result.Error != nil {
-			log.Printf("Error updating patient status: %v", result.Error)
-		}
+	}, input.NoRawat)
 
-		// Jadwalkan reset status setelah 5 menit
-		go func(noRawat string) {
-			time.Sleep(5 * time.Minute)
-			h.resetCallingStatus(noRawat)
-		}(input.NoRawat)
+	if err != nil {
+		c.JSON(statusErrorPanggilan(err), gin.H{
+			"status":  "error",
+			"message": "Gagal memanggil pasien: " + err.Error(),
+		})
+		return
 	}
 
 	// Mengembalikan response dalam format JSON
@@ -306,34 +494,272 @@ func (h *PanggilPoliHandler) PanggilPasienAPI(c *gin.Context) {
 		"data": gin.H{
 			"message": msg,
 		},
-		"message": "Pasien berhasil dipanggil",
+		"message": pesanBerhasilPanggil("Pasien berhasil dipanggil", msg),
 	})
 }
 
 // getPasienList mendapatkan daftar pasien untuk poli tertentu
 func (h *PanggilPoliHandler) getPasienList(kdRuangPoli string) []map[string]interface{} {
-	hari := services.GetDayList()[time.Now().Format("Monday")]
 	var results []map[string]interface{}
 
-	h.DB.Table("reg_periksa").
-		Select("reg_periksa.no_reg, reg_periksa.no_rawat, reg_periksa.no_rkm_medis, reg_periksa.kd_dokter, reg_periksa.kd_pj, jadwal.hari_kerja, jadwal.jam_mulai, bw_ruangpoli_dokter.kd_ruang_poli, bw_ruangpoli_dokter.nama_dokter, pasien.nm_pasien, bw_log_antrian_poli.status, penjab.png_jawab, poliklinik.nm_poli").
+	kolomJenis, args := kolomPrioritas(h.DB)
+
+	urutkanAntrian(queryAntrian(h.DB, kdRuangPoli)).
+		Select("reg_periksa.no_reg, "+kolomNomorAntrian+", reg_periksa.no_rawat, reg_periksa.no_rkm_medis, reg_periksa.kd_dokter, reg_periksa.kd_pj, jadwal.hari_kerja, jadwal.jam_mulai, "+kolomRuangPoli+", bw_ruangpoli_dokter.nama_dokter, pasien.nm_pasien, bw_log_antrian_poli.status, penjab.png_jawab, poliklinik.nm_poli, "+kolomJenis, args...).
 		Joins("LEFT JOIN bw_log_antrian_poli ON bw_log_antrian_poli.no_rawat = reg_periksa.no_rawat").
-		Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
-		Joins("JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
-		Joins("JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis").
 		Joins("JOIN penjab ON reg_periksa.kd_pj = penjab.kd_pj").
 		Joins("JOIN poliklinik ON reg_periksa.kd_poli = poliklinik.kd_poli").
-		Where("reg_periksa.tgl_registrasi = ?", time.Now().Format("2006-01-02")).
-		Where("jadwal.hari_kerja = ?", hari).
-		Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", kdRuangPoli).
-		Order("jadwal.jam_mulai asc").
-		Order("reg_periksa.no_reg asc").
-		Order("reg_periksa.jam_reg asc").
 		Find(&results)
 
+	h.tandaiEstimasiPasien(kdRuangPoli, results)
+
 	return results
 }
 
+// tandaiEstimasiPasien menambahkan posisi antrian dan perkiraan waktu panggil pada pasien
+// yang masih menunggu. Pasien lain mendapat nilai kosong.
+func (h *PanggilPoliHandler) tandaiEstimasiPasien(kdRuangPoli string, results []map[string]interface{}) {
+	urutan, err := daftarMenunggu(h.DB, kdRuangPoli, "reg_periksa.no_rawat, jadwal.jam_mulai")
+	if err != nil {
+		log.Printf("Gagal mengambil urutan antrian ruang poli %s: %v", kdRuangPoli, err)
+		return
+	}
+
+	estimasi, err := estimasiRuangPoli(h.DB, []string{kdRuangPoli})
+	if err != nil {
+		log.Printf("Gagal menghitung estimasi waktu tunggu ruang poli %s: %v", kdRuangPoli, err)
+	}
+
+	var kembali *time.Time
+	if jeda, _ := cariJedaRuangPoli(h.DB, kdRuangPoli); jeda != nil {
+		kembali = jeda.PerkiraanKembali
+	}
+	tandaiEstimasi(urutan, estimasi[kdRuangPoli], kembali)
+
+	posisi := make(map[string]map[string]interface{}, len(urutan))
+	for _, pasien := range urutan {
+		posisi[fmt.Sprint(pasien["no_rawat"])] = pasien
+	}
+
+	for _, pasien := range results {
+		menunggu, ok := posisi[fmt.Sprint(pasien["no_rawat"])]
+		if !ok {
+			pasien["posisi_antrian"] = nil
+			pasien["perkiraan_panggil"] = nil
+			pasien["perkiraan_menit"] = nil
+			continue
+		}
+		pasien["posisi_antrian"] = menunggu["posisi_antrian"]
+		pasien["perkiraan_panggil"] = menunggu["perkiraan_panggil"]
+		pasien["perkiraan_menit"] = menunggu["perkiraan_menit"]
+	}
+}
+
+// inputPanggilan adalah body opsional endpoint next dan recall. no_rawat_dipanggil berisi pasien
+// yang sedang dipanggil menurut tampilan petugas ("" jika tidak ada); jika berbeda dengan database,
+// panggilan ditolak dengan 409 karena petugas lain sudah memanggil lebih dulu.
+type inputPanggilan struct {
+	NoRawatDipanggil *string `json:"no_rawat_dipanggil"`
+}
+
+// bacaInputPanggilan membaca body opsional endpoint next dan recall. Body kosong diperbolehkan.
+func bacaInputPanggilan(c *gin.Context) (inputPanggilan, bool) {
+	var input inputPanggilan
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Format data tidak valid: " + err.Error(),
+		})
+		return input, false
+	}
+	return input, true
+}
+
+// PanggilBerikutnya memanggil pasien berikutnya yang menunggu pada ruang poli tertentu.
+// Pasien, display, dan nama ruang poli ditentukan dari database, bukan dari payload client.
+func (h *PanggilPoliHandler) PanggilBerikutnya(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	input, ok := bacaInputPanggilan(c)
+	if !ok {
+		return
+	}
+
+	// Ambil display dan nama ruang poli
+	ruangPoli, ok := h.cariRuangPoli(c, kdRuangPoli)
+	if !ok {
+		return
+	}
+
+	var msg PanggilPoliMessage
+	var pasien []map[string]interface{}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := kunciRuangPoli(tx, kdRuangPoli); err != nil {
+			return err
+		}
+		if err := pastikanPanggilanTerkini(tx, kdRuangPoli, input.NoRawatDipanggil); err != nil {
+			return err
+		}
+		if err := pastikanRuangAktif(tx, kdRuangPoli); err != nil {
+			return err
+		}
+
+		// Ambil pasien berikutnya sesuai urutan giliran panggil, termasuk selipan pasien prioritas
+		var err error
+		pasien, err = daftarMenunggu(tx, kdRuangPoli,
+			"reg_periksa.no_reg, reg_periksa.no_rawat, reg_periksa.kd_dokter, bw_ruangpoli_dokter.nama_dokter, pasien.nm_pasien")
+		if err != nil {
+			return err
+		}
+		if len(pasien) == 0 {
+			return errAntrianKosong
+		}
+
+		msg = PanggilPoliMessage{
+			NmPasien:    fmt.Sprint(pasien[0]["nm_pasien"]),
+			KdRuangPoli: ruangPoli.KdRuangPoli,
+			NmPoli:      ruangPoli.NamaRuangPoli,
+			NoReg:       fmt.Sprint(pasien[0]["no_reg"]),
+			KdDisplay:   ruangPoli.KdDisplay,
+		}
+		return catatPanggilan(tx, &msg, fmt.Sprint(pasien[0]["no_rawat"]))
+	})
+
+	if err != nil {
+		message := "Gagal memanggil pasien berikutnya: " + err.Error()
+		if errors.Is(err, errAntrianKosong) {
+			message = "Tidak ada pasien yang menunggu di " + ruangPoli.NamaRuangPoli
+		}
+		c.JSON(statusErrorPanggilan(err), gin.H{
+			"status":  "error",
+			"message": message,
+		})
+		return
+	}
+
+	msg = h.umumkanPanggilan(msg)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"no_rawat":    pasien[0]["no_rawat"],
+			"kd_dokter":   pasien[0]["kd_dokter"],
+			"nama_dokter": pasien[0]["nama_dokter"],
+			"message":     msg,
+		},
+		"message": pesanBerhasilPanggil("Pasien berikutnya berhasil dipanggil", msg),
+	})
+}
+
+// PanggilUlang memanggil ulang pasien yang sedang dipanggil pada ruang poli tertentu.
+// Jika jumlah panggilan sudah mencapai batas, pasien otomatis dipindahkan ke status terlewat (1).
+func (h *PanggilPoliHandler) PanggilUlang(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	input, ok := bacaInputPanggilan(c)
+	if !ok {
+		return
+	}
+
+	ruangPoli, ok := h.cariRuangPoli(c, kdRuangPoli)
+	if !ok {
+		return
+	}
+
+	var msg PanggilPoliMessage
+	var noRawat, status string
+	var jumlahPanggil, maksPanggilan int
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := kunciRuangPoli(tx, kdRuangPoli); err != nil {
+			return err
+		}
+		if err := pastikanPanggilanTerkini(tx, kdRuangPoli, input.NoRawatDipanggil); err != nil {
+			return err
+		}
+
+		// Ambil pasien yang sedang dipanggil (status=2)
+		var pasien []map[string]interface{}
+		err := queryAntrian(tx, kdRuangPoli).
+			Select("reg_periksa.no_reg, reg_periksa.no_rawat, pasien.nm_pasien, bw_log_antrian_poli.jumlah_panggil").
+			Joins("JOIN bw_log_antrian_poli ON reg_periksa.no_rawat = bw_log_antrian_poli.no_rawat").
+			Where("bw_log_antrian_poli.status = '2'").
+			Limit(1).
+			Find(&pasien).Error
+		if err != nil {
+			return err
+		}
+		if len(pasien) == 0 {
+			return errAntrianKosong
+		}
+
+		noRawat = fmt.Sprint(pasien[0]["no_rawat"])
+		jumlahPanggil = toInt(pasien[0]["jumlah_panggil"])
+
+		// Batas panggilan tercapai, pindahkan pasien ke daftar terlewat
+		maksPanggilan = getPengaturanRuangPoli(tx, kdRuangPoli).MaksPanggilan
+		if jumlahPanggil >= maksPanggilan {
+			err := tx.Table("bw_log_antrian_poli").
+				Where("no_rawat = ?", noRawat).
+				Update("status", "1").Error
+			if err != nil {
+				return err
+			}
+
+			status, err = terapkanKebijakanTerlewat(tx, noRawat, kdRuangPoli)
+			return err
+		}
+
+		status = "2"
+		msg = PanggilPoliMessage{
+			NmPasien:    fmt.Sprint(pasien[0]["nm_pasien"]),
+			KdRuangPoli: ruangPoli.KdRuangPoli,
+			NmPoli:      ruangPoli.NamaRuangPoli,
+			NoReg:       fmt.Sprint(pasien[0]["no_reg"]),
+			KdDisplay:   ruangPoli.KdDisplay,
+		}
+		return catatPanggilan(tx, &msg, noRawat)
+	})
+
+	if err != nil {
+		message := "Gagal memanggil ulang pasien: " + err.Error()
+		if errors.Is(err, errAntrianKosong) {
+			message = "Tidak ada pasien yang sedang dipanggil di " + ruangPoli.NamaRuangPoli
+		}
+		c.JSON(statusErrorPanggilan(err), gin.H{
+			"status":  "error",
+			"message": message,
+		})
+		return
+	}
+
+	if status != "2" {
+		h.Snapshot.TandaiBerubah(kdRuangPoli)
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"no_rawat":       noRawat,
+				"kd_ruang_poli":  kdRuangPoli,
+				"status":         status,
+				"jumlah_panggil": jumlahPanggil,
+			},
+			"message": fmt.Sprintf("Pasien tidak hadir setelah %d panggilan, dipindahkan ke daftar terlewat", jumlahPanggil),
+		})
+		return
+	}
+
+	msg = h.umumkanPanggilan(msg)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"no_rawat":       noRawat,
+			"maks_panggilan": maksPanggilan,
+			"message":        msg,
+		},
+		"message": pesanBerhasilPanggil(fmt.Sprintf("Pasien dipanggil ulang (panggilan ke-%d)", msg.JumlahPanggil), msg),
+	})
+}
+
 // HandleAntrianWebSocket menangani koneksi WebSocket untuk pembaruan antrian
 func (h *PanggilPoliHandler) HandleAntrianWebSocket(c *gin.Context) {
 	kdRuangPoli := c.Param("kd_ruang_poli")
@@ -465,6 +891,21 @@ func (h *PanggilPoliHandler) HandleLogAPI(c *gin.Context) {
 		return
 	}
 
+	// Terapkan kebijakan pengembalian untuk pasien yang tidak hadir
+	if status == "1" {
+		var err error
+		status, err = terapkanKebijakanTerlewat(h.DB, input.NoRawat, input.KdRuangPoli)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Gagal mengembalikan pasien ke antrian: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	h.Snapshot.TandaiBerubah(input.KdRuangPoli)
+
 	// Mengembalikan response dalam format JSON
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -481,12 +922,10 @@ func (h *PanggilPoliHandler) HandleLogAPI(c *gin.Context) {
 func (h *PanggilPoliHandler) ResetLogAPI(c *gin.Context) {
 	noRawat := c.Param("no_rawat")
 
-	result := h.DB.Table("bw_log_antrian_poli").Where("no_rawat = ?", noRawat).Delete(nil)
-
-	if result.Error != nil {
+	if err := h.hapusLogAntrian(noRawat); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Gagal mereset status: " + result.Error.Error(),
+			"message": "Gagal mereset status: " + err.Error(),
 		})
 		return
 	}
@@ -500,3 +939,179 @@ func (h *PanggilPoliHandler) ResetLogAPI(c *gin.Context) {
 		"message": "Reset log berhasil",
 	})
 }
+
+// KembalikanAntrianAPI mengembalikan pasien terlewat (status=1) ke antrian saat pasien akhirnya hadir.
+// Posisi pasien ditentukan oleh pengaturan ruang poli.
+func (h *PanggilPoliHandler) KembalikanAntrianAPI(c *gin.Context) {
+	noRawat := c.Param("no_rawat")
+
+	var logAntrian models.LogAntrianPoli
+	if err := h.DB.Where("no_rawat = ?", noRawat).First(&logAntrian).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Log antrian pasien tidak ditemukan",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengambil log antrian: " + err.Error(),
+		})
+		return
+	}
+
+	if logAntrian.Status != "1" {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Pasien tidak berada dalam daftar terlewat",
+		})
+		return
+	}
+
+	pengaturan := getPengaturanRuangPoli(h.DB, logAntrian.KdRuangPoli)
+	sisaLewati, err := kembalikanKeAntrian(h.DB, noRawat, logAntrian.KdRuangPoli, pengaturan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengembalikan pasien ke antrian: " + err.Error(),
+		})
+		return
+	}
+	h.Snapshot.TandaiBerubah(logAntrian.KdRuangPoli)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"no_rawat":      noRawat,
+			"kd_ruang_poli": logAntrian.KdRuangPoli,
+			"status":        "3",
+			"sisa_lewati":   sisaLewati,
+		},
+		"message": fmt.Sprintf("Pasien dikembalikan ke antrian setelah %d pasien", sisaLewati),
+	})
+}
+
+// PindahRuangPoliAPI memindahkan pasien ke ruang poli lain untuk kunjungan hari ini.
+// Posisi di ruang tujuan: "tetap" mengikuti urutan antrian normal, "awal" dipanggil paling awal,
+// atau "akhir" ditempatkan di akhir antrian.
+func (h *PanggilPoliHandler) PindahRuangPoliAPI(c *gin.Context) {
+	var input struct {
+		NoRawat     string `json:"no_rawat" binding:"required"`
+		KdRuangPoli string `json:"kd_ruang_poli" binding:"required"`
+		Posisi      string `json:"posisi"`
+		Alasan      string `json:"alasan"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Format data tidak valid: " + err.Error(),
+		})
+		return
+	}
+
+	switch input.Posisi {
+	case "":
+		input.Posisi = models.PosisiPindahTetap
+	case models.PosisiPindahTetap, models.PosisiPindahAwal, models.PosisiPindahAkhir:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Posisi harus tetap, awal, atau akhir",
+		})
+		return
+	}
+
+	ruangTujuan, ok := h.cariRuangPoli(c, input.KdRuangPoli)
+	if !ok {
+		return
+	}
+
+	// Tentukan ruang poli pasien saat ini
+	var ruangAsal []map[string]interface{}
+	h.DB.Table("reg_periksa").
+		Select(kolomRuangPoli).
+		Joins("JOIN bw_ruangpoli_dokter ON reg_periksa.kd_dokter = bw_ruangpoli_dokter.kd_dokter").
+		Joins("LEFT JOIN bw_pindah_ruang_poli ON reg_periksa.no_rawat = bw_pindah_ruang_poli.no_rawat").
+		Where("reg_periksa.no_rawat = ?", input.NoRawat).
+		Limit(1).
+		Find(&ruangAsal)
+
+	if len(ruangAsal) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Pasien tidak ditemukan atau dokternya belum memiliki ruang poli",
+		})
+		return
+	}
+
+	kdRuangAsal := fmt.Sprint(ruangAsal[0]["kd_ruang_poli"])
+	if kdRuangAsal == ruangTujuan.KdRuangPoli {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Pasien sudah berada di " + ruangTujuan.NamaRuangPoli,
+		})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Kunci kedua ruang dengan urutan tetap agar tidak terjadi deadlock
+		ruangDikunci := []string{kdRuangAsal, ruangTujuan.KdRuangPoli}
+		if ruangDikunci[0] > ruangDikunci[1] {
+			ruangDikunci[0], ruangDikunci[1] = ruangDikunci[1], ruangDikunci[0]
+		}
+		for _, kdRuangPoli := range ruangDikunci {
+			if err := kunciRuangPoli(tx, kdRuangPoli); err != nil {
+				return err
+			}
+		}
+
+		// Hitung antrian tujuan sebelum pasien dipindahkan
+		sisaLewati := 0
+		if input.Posisi == models.PosisiPindahAkhir {
+			jumlahMenunggu, err := hitungMenunggu(tx, ruangTujuan.KdRuangPoli)
+			if err != nil {
+				return err
+			}
+			sisaLewati = jumlahMenunggu
+		}
+
+		err := tx.Save(&models.PindahRuangPoli{
+			NoRawat:         input.NoRawat,
+			KdRuangPoli:     ruangTujuan.KdRuangPoli,
+			KdRuangPoliAsal: kdRuangAsal,
+			Alasan:          input.Alasan,
+			WaktuPindah:     time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// Pasien menunggu kembali di ruang tujuan
+		if input.Posisi == models.PosisiPindahTetap {
+			return tx.Table("bw_log_antrian_poli").Where("no_rawat = ?", input.NoRawat).Delete(nil).Error
+		}
+		return sisipkanAntrian(tx, input.NoRawat, ruangTujuan.KdRuangPoli, sisaLewati)
+	})
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal memindahkan pasien: " + err.Error(),
+		})
+		return
+	}
+	h.Snapshot.TandaiBerubah(kdRuangAsal, ruangTujuan.KdRuangPoli)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"no_rawat":           input.NoRawat,
+			"kd_ruang_poli_asal": kdRuangAsal,
+			"kd_ruang_poli":      ruangTujuan.KdRuangPoli,
+			"posisi":             input.Posisi,
+		},
+		"message": "Pasien berhasil dipindahkan ke " + ruangTujuan.NamaRuangPoli,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+func TestResetCallingStatus(t *testing.T) {
+	const noRawat = "2026/10/19/000001"
+	kedaluwarsa := []hasilPalsu{
+		{memuat: "DISTINCT", kolom: []string{"kd_ruang_poli"}, baris: [][]driver.Value{{"R1"}}},
+		{memuat: "status = '2' AND batas_dipanggil", kolom: []string{"no_rawat"}, baris: [][]driver.Value{{noRawat}}},
+	}
+	ruangPoli := hasilPalsu{memuat: "FROM `bw_ruang_poli`", kolom: []string{"kd_ruang_poli"}, baris: [][]driver.Value{{"R1"}}}
+	kebijakan := func(kebijakan string) hasilPalsu {
+		return hasilPalsu{
+			memuat: "FROM `bw_pengaturan_ruang_poli`",
+			kolom:  []string{"kd_ruang_poli", "kebijakan_terlewat", "jumlah_sisip"},
+			baris:  [][]driver.Value{{"R1", kebijakan, int64(2)}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		hasil        []hasilPalsu
+		terlewat     bool
+		dikembalikan bool
+	}{
+		{
+			name:     "kebijakan manual tetap di daftar terlewat",
+			hasil:    append([]hasilPalsu{ruangPoli}, kedaluwarsa...),
+			terlewat: true,
+		},
+		{
+			name:         "kebijakan otomatis dikembalikan ke antrian",
+			hasil:        append([]hasilPalsu{ruangPoli, kebijakan(models.KebijakanTerlewatSetelah)}, kedaluwarsa...),
+			terlewat:     true,
+			dikembalikan: true,
+		},
+		{
+			name:  "ruang poli tidak ditemukan",
+			hasil: kedaluwarsa,
+		},
+		{name: "tidak ada panggilan kedaluwarsa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			NewPanggilPoliHandler(db).resetCallingStatus()
+
+			query := fake.Query()
+			terlewat := cariQuery(query, "SET status = '1', batas_dipanggil = NULL")
+			dikembalikan := cariQuery(query, "VALUES (?, ?, '3'")
+			if (terlewat >= 0) != tt.terlewat || (dikembalikan >= 0) != tt.dikembalikan {
+				t.Fatalf("terlewat %v dikembalikan %v, ingin %v %v", terlewat >= 0, dikembalikan >= 0, tt.terlewat, tt.dikembalikan)
+			}
+			if tt.terlewat && strings.Contains(query[terlewat], "jumlah_panggil") {
+				t.Fatalf("jumlah panggilan diubah saat ditandai terlewat: %s", query[terlewat])
+			}
+			if tt.terlewat && cariQuery(query, "FOR UPDATE") > terlewat {
+				t.Fatalf("ruang poli tidak dikunci sebelum pasien ditandai terlewat")
+			}
+			for _, q := range query {
+				if strings.HasPrefix(strings.TrimSpace(q), "DELETE") {
+					t.Fatalf("log antrian dihapus: %s", q)
+				}
+			}
+		})
+	}
+}
+
+func TestPesanBerhasilPanggil(t *testing.T) {
+	if got := pesanBerhasilPanggil("Pasien berhasil dipanggil", PanggilPoliMessage{}); got != "Pasien berhasil dipanggil" {
+		t.Fatalf("pesan %q", got)
+	}
+	if got := pesanBerhasilPanggil("Pasien berhasil dipanggil", PanggilPoliMessage{Ditahan: true}); got == "Pasien berhasil dipanggil" {
+		t.Fatalf("pesan panggilan ditahan tanpa keterangan standby")
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// hurufKodePairing adalah karakter kode pairing, tanpa huruf dan angka yang mudah tertukar (0/O, 1/I)
+const hurufKodePairing = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// panjangKodePairing adalah jumlah karakter kode pairing yang ditampilkan di layar perangkat
+const panjangKodePairing = 6
+
+// masaBerlakuKodePairing adalah lama kode pairing dapat dipasangkan oleh admin
+const masaBerlakuKodePairing = 10 * time.Minute
+
+// selangTerakhirAktif membatasi seberapa sering waktu terakhir aktif perangkat diperbarui
+const selangTerakhirAktif = time.Minute
+
+// SubprotokolDisplay adalah subprotokol WebSocket display. Browser tidak dapat mengirim header
+// Authorization pada WebSocket, sehingga token dikirim sebagai subprotokol tambahan berawalan "token.",
+// misalnya new WebSocket(url, ["display", "token." + token]). Server selalu memilih subprotokol ini
+// sehingga token tidak dikembalikan pada response handshake.
+const SubprotokolDisplay = "display"
+
+// awalanSubprotokolToken adalah awalan subprotokol WebSocket yang berisi token perangkat
+const awalanSubprotokolToken = "token."
+
+// kunciPerangkat adalah kunci gin.Context untuk perangkat yang lolos WajibToken
+const kunciPerangkat = "perangkat"
+
+// PerangkatDisplayHandler menangani pairing dan pencabutan perangkat display
+type PerangkatDisplayHandler struct {
+	DB     *gorm.DB
+	Socket *DisplaySocketHub // Koneksi perangkat yang dicabut ditutup melalui hub ini
+}
+
+// NewPerangkatDisplayHandler membuat instance baru dari PerangkatDisplayHandler
+func NewPerangkatDisplayHandler(db *gorm.DB) *PerangkatDisplayHandler {
+	return &PerangkatDisplayHandler{DB: db}
+}
+
+// SetSocketHub menetapkan hub WebSocket display untuk handler ini
+func (h *PerangkatDisplayHandler) SetSocketHub(socket *DisplaySocketHub) {
+	h.Socket = socket
+}
+
+// hashToken mengembalikan hash SHA-256 token perangkat dalam bentuk hex
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// buatKodePairing membuat kode pairing acak
+func buatKodePairing() (string, error) {
+	kode := make([]byte, panjangKodePairing)
+	maks := big.NewInt(int64(len(hurufKodePairing)))
+	for i := range kode {
+		n, err := rand.Int(rand.Reader, maks)
+		if err != nil {
+			return "", err
+		}
+		kode[i] = hurufKodePairing[n.Int64()]
+	}
+	return string(kode), nil
+}
+
+// buatTokenPerangkat membuat token perangkat acak 256 bit
+func buatTokenPerangkat() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// tokenPermintaan mengambil token dari header Authorization: Bearer, atau dari subprotokol
+// SubprotokolDisplay pada permintaan WebSocket. Token tidak pernah dibaca dari query string
+// karena URL lengkap tercatat di log akses dan riwayat browser.
+func tokenPermintaan(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		for _, protokol := range websocket.Subprotocols(c.Request) {
+			if strings.HasPrefix(protokol, awalanSubprotokolToken) {
+				return strings.TrimPrefix(protokol, awalanSubprotokolToken)
+			}
+		}
+	}
+	return ""
+}
+
+// cariPerangkat mencari perangkat berdasarkan token, nil jika token tidak dikenal
+func (h *PerangkatDisplayHandler) cariPerangkat(token string) (*models.PerangkatDisplay, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var perangkat []models.PerangkatDisplay
+	if err := h.DB.Where("token_hash = ?", hashToken(token)).Limit(1).Find(&perangkat).Error; err != nil {
+		return nil, err
+	}
+	if len(perangkat) == 0 {
+		return nil, nil
+	}
+	return &perangkat[0], nil
+}
+
+// WajibToken mengembalikan gin middleware yang hanya meloloskan perangkat aktif yang dipasangkan
+// ke kd_display pada rute. Tidak memeriksa apa pun jika WAJIB_TOKEN_DISPLAY=false.
+func (h *PerangkatDisplayHandler) WajibToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.GetWajibTokenDisplay() {
+			c.Next()
+			return
+		}
+
+		perangkat, err := h.cariPerangkat(tokenPermintaan(c))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa token perangkat"})
+			return
+		}
+		if perangkat == nil || perangkat.Status != models.PerangkatAktif {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Perangkat belum dipasangkan atau sudah dicabut"})
+			return
+		}
+		if perangkat.KdDisplay != c.Param("kd_display") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Perangkat tidak dipasangkan ke display ini"})
+			return
+		}
+
+		sekarang := time.Now()
+		if perangkat.TerakhirAktif == nil || sekarang.Sub(*perangkat.TerakhirAktif) > selangTerakhirAktif {
+			h.DB.Model(perangkat).Update("terakhir_aktif", sekarang)
+		}
+
+		c.Set(kunciPerangkat, perangkat)
+		c.Next()
+	}
+}
+
+// WajibAdmin mengembalikan gin middleware yang hanya meloloskan permintaan dengan header
+// Authorization: Bearer berisi ADMIN_TOKEN. Semua permintaan ditolak jika ADMIN_TOKEN kosong.
+func WajibAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := services.GetAdminToken()
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"message": "ADMIN_TOKEN belum diatur pada server",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+
+		// Bandingkan hash agar waktu perbandingan tidak bergantung pada isi dan panjang token
+		token := hashToken(tokenPermintaan(c))
+		if subtle.ConstantTimeCompare([]byte(token), []byte(hashToken(adminToken))) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "Token admin tidak valid",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// IDPerangkat mengembalikan ID perangkat yang lolos WajibToken, 0 jika token tidak diperiksa
+func IDPerangkat(c *gin.Context) uint {
+	if perangkat, ok := c.Get(kunciPerangkat); ok {
+		return perangkat.(*models.PerangkatDisplay).ID
+	}
+	return 0
+}
+
+// MintaPairing dipanggil layar baru untuk mendapatkan kode pairing dan token.
+// Token baru dapat dipakai setelah admin memasangkan kode ke sebuah display.
+func (h *PerangkatDisplayHandler) MintaPairing(c *gin.Context) {
+	token, err := buatTokenPerangkat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal membuat token perangkat",
+		})
+		return
+	}
+
+	sekarang := time.Now()
+	perangkat := models.PerangkatDisplay{
+		TokenHash:       hashToken(token),
+		Status:          models.PerangkatMenunggu,
+		KodeKedaluwarsa: sekarang.Add(masaBerlakuKodePairing),
+		Dibuat:          sekarang,
+	}
+
+	// Kode pairing yang sudah kedaluwarsa dilepas agar dapat dipakai lagi
+	h.DB.Model(&models.PerangkatDisplay{}).
+		Where("status = ? AND kode_kedaluwarsa < ?", models.PerangkatMenunggu, sekarang).
+		Update("kode_pairing", nil)
+
+	// Ulangi jika kode acak bertabrakan dengan kode yang masih berlaku
+	for percobaan := 0; percobaan < 5; percobaan++ {
+		kode, err := buatKodePairing()
+		if err != nil {
+			break
+		}
+		perangkat.KodePairing = &kode
+		if err = h.DB.Create(&perangkat).Error; err == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status": "success",
+				"data": gin.H{
+					"kode_pairing":     kode,
+					"token":            token,
+					"kode_kedaluwarsa": perangkat.KodeKedaluwarsa,
+				},
+				"message": "Tampilkan kode pairing dan tunggu admin memasangkan perangkat",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"status":  "error",
+		"message": "Gagal membuat kode pairing, silakan coba lagi",
+	})
+}
+
+// StatusPerangkat dipanggil perangkat dengan tokennya untuk mengetahui apakah sudah dipasangkan
+func (h *PerangkatDisplayHandler) StatusPerangkat(c *gin.Context) {
+	perangkat, err := h.cariPerangkat(tokenPermintaan(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal memeriksa token perangkat",
+		})
+		return
+	}
+	if perangkat == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "Token perangkat tidak dikenal",
+		})
+		return
+	}
+
+	status := perangkat.Status
+	if status == models.PerangkatMenunggu && time.Now().After(perangkat.KodeKedaluwarsa) {
+		status = "kedaluwarsa"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"status":     status,
+			"kd_display": perangkat.KdDisplay,
+		},
+	})
+}
+
+// GetAllPerangkat mengembalikan daftar semua perangkat display dalam format JSON
+func (h *PerangkatDisplayHandler) GetAllPerangkat(c *gin.Context) {
+	perangkat := []models.PerangkatDisplay{}
+	h.DB.Order("dibuat desc").Find(&perangkat)
+	c.JSON(http.StatusOK, perangkat)
+}
+
+// PasangkanPerangkat memasangkan perangkat dengan kode pairing yang tampil di layarnya ke sebuah display
+func (h *PerangkatDisplayHandler) PasangkanPerangkat(c *gin.Context) {
+	var input struct {
+		KodePairing string `json:"kode_pairing" binding:"required"`
+		KdDisplay   string `json:"kd_display" binding:"required"`
+		Nama        string `json:"nama"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Kode pairing dan display harus diisi",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	kode := strings.ToUpper(strings.TrimSpace(input.KodePairing))
+
+	var jumlah int64
+	h.DB.Table("bw_display_poli").Where("kd_display = ?", input.KdDisplay).Count(&jumlah)
+	if jumlah == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Display tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	sekarang := time.Now()
+	result := h.DB.Model(&models.PerangkatDisplay{}).
+		Where("kode_pairing = ? AND status = ? AND kode_kedaluwarsa >= ?", kode, models.PerangkatMenunggu, sekarang).
+		Updates(map[string]interface{}{
+			"kode_pairing": nil,
+			"kd_display":   input.KdDisplay,
+			"nama":         input.Nama,
+			"status":       models.PerangkatAktif,
+			"dipasangkan":  sekarang,
+		})
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat memasangkan perangkat",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Kode pairing tidak ditemukan atau sudah kedaluwarsa",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Perangkat berhasil dipasangkan ke display " + input.KdDisplay + "!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// CabutPerangkat mencabut token perangkat dan menutup koneksi WebSocket-nya
+func (h *PerangkatDisplayHandler) CabutPerangkat(c *gin.Context) {
+	var perangkat models.PerangkatDisplay
+	err := h.DB.Where("id = ?", c.Param("id")).First(&perangkat).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Perangkat tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if err == nil {
+		err = h.DB.Model(&perangkat).Updates(map[string]interface{}{
+			"kode_pairing": nil,
+			"status":       models.PerangkatDicabut,
+			"dicabut":      time.Now(),
+		}).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat mencabut perangkat",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.Socket.PutuskanPerangkat(perangkat.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Perangkat berhasil dicabut!",
+		"color":   "warning",
+		"icon":    "check",
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+func TestWajibAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		status     int
+	}{
+		{"token benar", "rahasia", "Bearer rahasia", http.StatusOK},
+		{"token salah", "rahasia", "Bearer salah", http.StatusUnauthorized},
+		{"tanpa header", "rahasia", "", http.StatusUnauthorized},
+		{"bukan bearer", "rahasia", "rahasia", http.StatusUnauthorized},
+		{"ADMIN_TOKEN kosong menolak semua", "", "Bearer ", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_TOKEN", tt.adminToken)
+
+			r := gin.New()
+			r.DELETE("/api/perangkat/:id", WajibAdmin(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/perangkat/1", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestTokenPermintaan(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		token  string
+	}{
+		{"header bearer", "/api/display/poli/D1", map[string]string{"Authorization": "Bearer abc"}, "abc"},
+		{"query diabaikan", "/api/display/poli/D1?token=abc", nil, ""},
+		{
+			name: "subprotokol websocket",
+			path: "/ws/D1",
+			header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "display, token.abc",
+			},
+			token: "abc",
+		},
+		{"subprotokol tanpa upgrade diabaikan", "/api/display/poli/D1", map[string]string{"Sec-WebSocket-Protocol": "display, token.abc"}, ""},
+		{
+			name: "header bearer didahulukan",
+			path: "/ws/D1",
+			header: map[string]string{
+				"Authorization":          "Bearer xyz",
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "display, token.abc",
+			},
+			token: "xyz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				c.Request.Header.Set(k, v)
+			}
+
+			if got := tokenPermintaan(c); got != tt.token {
+				t.Fatalf("token %q, ingin %q", got, tt.token)
+			}
+		})
+	}
+}
+
+func TestWajibToken(t *testing.T) {
+	aktif := time.Now()
+	perangkat := func(kdDisplay, status string) []hasilPalsu {
+		return []hasilPalsu{{
+			memuat: "token_hash",
+			kolom:  []string{"id", "kd_display", "status", "terakhir_aktif"},
+			baris:  [][]driver.Value{{int64(7), kdDisplay, status, aktif}},
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		wajib  string
+		hasil  []hasilPalsu
+		path   string
+		header string
+		status int
+	}{
+		{"perangkat aktif", "true", perangkat("D1", models.PerangkatAktif), "/api/display/poli/D1", "Bearer abc", http.StatusOK},
+		{"token tidak dikenal", "true", nil, "/api/display/poli/D1", "Bearer abc", http.StatusUnauthorized},
+		{"token di query ditolak", "true", perangkat("D1", models.PerangkatAktif), "/api/display/poli/D1?token=abc", "", http.StatusUnauthorized},
+		{"perangkat dicabut", "true", perangkat("D1", models.PerangkatDicabut), "/api/display/poli/D1", "Bearer abc", http.StatusUnauthorized},
+		{"perangkat menunggu pairing", "true", perangkat("", models.PerangkatMenunggu), "/api/display/poli/D1", "Bearer abc", http.StatusUnauthorized},
+		{"display lain", "true", perangkat("D2", models.PerangkatAktif), "/api/display/poli/D1", "Bearer abc", http.StatusForbidden},
+		{"token tidak diwajibkan", "false", nil, "/api/display/poli/D1", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WAJIB_TOKEN_DISPLAY", tt.wajib)
+			db, _ := bukaDatabasePalsu(t, tt.hasil...)
+			h := NewPerangkatDisplayHandler(db)
+
+			var id uint
+			r := gin.New()
+			r.GET("/api/display/poli/:kd_display", h.WajibToken(), func(c *gin.Context) {
+				id = IDPerangkat(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && tt.wajib == "true" && id != 7 {
+				t.Fatalf("ID perangkat %d, ingin 7", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// PrioritasHandler menangani aturan prioritas antrian dan penandaan pasien prioritas
+type PrioritasHandler struct {
+	DB *gorm.DB
+}
+
+// NewPrioritasHandler membuat instance baru dari PrioritasHandler
+func NewPrioritasHandler(db *gorm.DB) *PrioritasHandler {
+	return &PrioritasHandler{DB: db}
+}
+
+// GetAturanPrioritas mengembalikan daftar aturan prioritas dalam format JSON
+func (h *PrioritasHandler) GetAturanPrioritas(c *gin.Context) {
+	var aturan []models.AturanPrioritas
+	h.DB.Order("id asc").Find(&aturan)
+
+	if len(aturan) == 0 {
+		c.JSON(http.StatusOK, []models.AturanPrioritas{})
+		return
+	}
+
+	c.JSON(http.StatusOK, aturan)
+}
+
+// TambahAturanPrioritas menambahkan aturan prioritas baru
+func (h *PrioritasHandler) TambahAturanPrioritas(c *gin.Context) {
+	var input struct {
+		Jenis string `json:"jenis" binding:"required"`
+		Nilai string `json:"nilai"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jenis prioritas harus diisi",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	switch input.Jenis {
+	case models.PrioritasLansia:
+		if toInt(input.Nilai) < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Umur minimal lansia harus berupa angka",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+	case models.PrioritasPenjab:
+		if input.Nilai == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Kode penjamin harus diisi",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+	case models.PrioritasDisabilitas, models.PrioritasHamil:
+		input.Nilai = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jenis prioritas harus lansia, disabilitas, hamil, atau penjab",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	result := h.DB.Create(&models.AturanPrioritas{Jenis: input.Jenis, Nilai: input.Nilai})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menambahkan aturan prioritas",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Aturan prioritas berhasil ditambahkan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// HapusAturanPrioritas menghapus aturan prioritas
+func (h *PrioritasHandler) HapusAturanPrioritas(c *gin.Context) {
+	result := h.DB.Where("id = ?", c.Param("id")).Delete(&models.AturanPrioritas{})
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menghapus aturan prioritas",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Aturan prioritas berhasil dihapus!",
+		"color":   "warning",
+		"icon":    "check",
+	})
+}
+
+// TandaiPrioritasPasien menandai pasien sebagai prioritas (disabilitas atau hamil) untuk kunjungan tertentu
+func (h *PrioritasHandler) TandaiPrioritasPasien(c *gin.Context) {
+	var input struct {
+		NoRawat    string `json:"no_rawat" binding:"required"`
+		Jenis      string `json:"jenis" binding:"required"`
+		Keterangan string `json:"keterangan"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Format data tidak valid: " + err.Error(),
+		})
+		return
+	}
+
+	if input.Jenis != models.PrioritasDisabilitas && input.Jenis != models.PrioritasHamil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Jenis prioritas pasien harus disabilitas atau hamil",
+		})
+		return
+	}
+
+	prioritas := models.PrioritasPasien{
+		NoRawat:    input.NoRawat,
+		Jenis:      input.Jenis,
+		Keterangan: input.Keterangan,
+	}
+	if err := h.DB.Save(&prioritas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal menandai pasien prioritas: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    prioritas,
+		"message": "Pasien berhasil ditandai sebagai prioritas",
+	})
+}
+
+// HapusPrioritasPasien menghapus tanda prioritas pasien
+func (h *PrioritasHandler) HapusPrioritasPasien(c *gin.Context) {
+	noRawat := c.Param("no_rawat")
+
+	result := h.DB.Where("no_rawat = ?", noRawat).Delete(&models.PrioritasPasien{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal menghapus tanda prioritas: " + result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"no_rawat": noRawat,
+		},
+		"message": "Tanda prioritas pasien berhasil dihapus",
+	})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+)
+
+// tingkatSamaran mengurutkan kebijakan samaran nama dari yang paling terbuka
+var tingkatSamaran = map[string]int{
+	models.SamaranPenuh:     0,
+	models.SamaranNamaDepan: 1,
+	models.SamaranInisial:   2,
+	models.SamaranNomor:     3,
+}
+
+// samaranNamaValid memeriksa kebijakan samaran nama
+func samaranNamaValid(kebijakan string) bool {
+	_, ok := tingkatSamaran[kebijakan]
+	return ok
+}
+
+// samaranLebihKetat mengembalikan kebijakan yang paling sedikit menampilkan nama.
+// Kebijakan kosong atau tidak dikenal dianggap penuh.
+func samaranLebihKetat(kebijakan ...string) string {
+	hasil := models.SamaranPenuh
+	for _, k := range kebijakan {
+		if tingkatSamaran[k] > tingkatSamaran[hasil] {
+			hasil = k
+		}
+	}
+	return hasil
+}
+
+// samarkanNama menyamarkan nama pasien sesuai kebijakan, misalnya BUDI SANTOSO menjadi BUDI S*** atau B. S.
+func samarkanNama(nama, kebijakan string) string {
+	kata := strings.Fields(strings.ReplaceAll(nama, ",", " "))
+
+	switch kebijakan {
+	case models.SamaranNamaDepan:
+		if len(kata) == 0 {
+			return ""
+		}
+		hasil := []string{kata[0]}
+		for _, k := range kata[1:] {
+			hasil = append(hasil, hurufPertama(k)+"***")
+		}
+		return strings.Join(hasil, " ")
+	case models.SamaranInisial:
+		hasil := make([]string, len(kata))
+		for i, k := range kata {
+			hasil[i] = hurufPertama(k) + "."
+		}
+		return strings.Join(hasil, " ")
+	case models.SamaranNomor:
+		return ""
+	default:
+		return nama
+	}
+}
+
+// hurufPertama mengembalikan huruf pertama sebuah kata
+func hurufPertama(kata string) string {
+	r, _ := utf8.DecodeRuneInString(kata)
+	return string(r)
+}
+
+// samarkanPasien menyamarkan kolom nm_pasien pada daftar pasien sesuai kebijakan
+func samarkanPasien(pasienList []map[string]interface{}, kebijakan string) {
+	if kebijakan == models.SamaranPenuh {
+		return
+	}
+	for _, pasien := range pasienList {
+		if nama, ok := pasien["nm_pasien"]; ok {
+			pasien["nm_pasien"] = samarkanNama(stringValue(nama), kebijakan)
+		}
+	}
+}
+
+// samaranDisplay mengambil kebijakan samaran nama beberapa display sekaligus.
+// Jika query gagal, semua display memakai kebijakan nomor agar nama tidak bocor.
+func samaranDisplay(db *gorm.DB, kdDisplayList []string) (map[string]string, error) {
+	hasil := make(map[string]string, len(kdDisplayList))
+	for _, kd := range kdDisplayList {
+		hasil[kd] = models.SamaranPenuh
+	}
+	if len(kdDisplayList) == 0 {
+		return hasil, nil
+	}
+
+	var tersimpan []models.PengaturanDisplay
+	if err := db.Select("kd_display, samaran_nama").Where("kd_display IN ?", kdDisplayList).Find(&tersimpan).Error; err != nil {
+		for _, kd := range kdDisplayList {
+			hasil[kd] = models.SamaranNomor
+		}
+		return hasil, err
+	}
+	for _, pengaturan := range tersimpan {
+		hasil[pengaturan.KdDisplay] = samaranLebihKetat(pengaturan.SamaranNama)
+	}
+	return hasil, nil
+}
+
+// teksPanggilan membuat teks TTS panggilan pasien. Nama yang disamarkan tidak dibacakan:
+// nama_depan hanya membacakan nama depan, inisial dan nomor hanya membacakan nomor antrian.
+func teksPanggilan(msg PanggilPoliMessage, kebijakan string) string {
+	nomor := msg.NoReg
+	if msg.NoAntrian != "" {
+		nomor = ejaanNomorAntrian(msg.NoAntrian)
+	}
+
+	nama := msg.NmPasien
+	switch kebijakan {
+	case models.SamaranNamaDepan:
+		if kata := strings.Fields(strings.ReplaceAll(nama, ",", " ")); len(kata) > 0 {
+			nama = kata[0]
+		}
+	case models.SamaranInisial, models.SamaranNomor:
+		nama = ""
+	}
+
+	if nama == "" {
+		return fmt.Sprintf("Nomor antrian %s, silakan menuju %s", nomor, msg.NmPoli)
+	}
+	return fmt.Sprintf("Nomor antrian %s, atas nama %s, silakan menuju %s", nomor, nama, msg.NmPoli)
+}
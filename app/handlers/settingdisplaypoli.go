@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
 )
 
 // SettingDisplayPoliHandler menangani pengaturan display poli
 type SettingDisplayPoliHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Socket *DisplaySocketHub // Koneksi display yang menerima perubahan layout
 }
 
 // NewSettingDisplayPoliHandler membuat instance baru dari SettingDisplayPoliHandler
@@ -17,6 +21,12 @@ func NewSettingDisplayPoliHandler(db *gorm.DB) *SettingDisplayPoliHandler {
 	return &SettingDisplayPoliHandler{DB: db}
 }
 
+// SetSocketHub menetapkan hub WebSocket display dan mendaftarkan pengiriman layout saat display terhubung
+func (h *SettingDisplayPoliHandler) SetSocketHub(socket *DisplaySocketHub) {
+	h.Socket = socket
+	socket.TambahPesanAwal(h.pesanLayoutDisplay)
+}
+
 // HandleSettings menampilkan halaman pengaturan display poli
 func (h *SettingDisplayPoliHandler) HandleSettings(c *gin.Context) {
 	displays := h.getAllDisplay()
@@ -105,13 +115,49 @@ func (h *SettingDisplayPoliHandler) EditDisplay(c *gin.Context) {
 	})
 }
 
-// DeleteDisplay menghapus display poli yang ada
+// DeleteDisplay menghapus display poli yang ada beserta ruang poli, jadwal operasi, layout, playlist,
+// dan running text-nya. Perangkat yang dipasangkan ke display ikut dicabut dan koneksinya diputus,
+// sehingga tidak ada data maupun akses lama yang muncul kembali jika kode display dipakai ulang.
 func (h *SettingDisplayPoliHandler) DeleteDisplay(c *gin.Context) {
 	kdDisplay := c.Param("kd_display")
 
-	result := h.DB.Table("bw_display_poli").Where("kd_display = ?", kdDisplay).Delete(nil)
+	var dicabut []uint
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.DisplayRuangPoli{},
+			&models.JadwalOperasiDisplay{},
+			&models.PengaturanDisplay{},
+			&models.PlaylistDisplay{},
+			&models.RunningText{},
+		} {
+			if err := tx.Where("kd_display = ?", kdDisplay).Delete(model).Error; err != nil {
+				return err
+			}
+		}
 
-	if result.Error != nil {
+		err := tx.Model(&models.PerangkatDisplay{}).
+			Where("kd_display = ? AND status <> ?", kdDisplay, models.PerangkatDicabut).
+			Pluck("id", &dicabut).Error
+		if err != nil {
+			return err
+		}
+		if len(dicabut) > 0 {
+			err = tx.Model(&models.PerangkatDisplay{}).
+				Where("id IN ?", dicabut).
+				Updates(map[string]interface{}{
+					"kode_pairing": nil,
+					"status":       models.PerangkatDicabut,
+					"dicabut":      time.Now(),
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Table("bw_display_poli").Where("kd_display = ?", kdDisplay).Delete(nil).Error
+	})
+
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Terjadi kesalahan saat menghapus display poli",
 			"color":   "danger",
@@ -120,6 +166,10 @@ func (h *SettingDisplayPoliHandler) DeleteDisplay(c *gin.Context) {
 		return
 	}
 
+	for _, id := range dicabut {
+		h.Socket.PutuskanPerangkat(id)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Display berhasil dihapus!",
 		"color":   "warning",
@@ -136,3 +186,150 @@ func (h *SettingDisplayPoliHandler) getAllDisplay() []map[string]interface{} {
 
 	return results
 }
+
+// getPengaturanDisplay mendapatkan pengaturan layout display, atau nilai default jika belum diatur
+func getPengaturanDisplay(db *gorm.DB, kdDisplay string) models.PengaturanDisplay {
+	pengaturan := models.PengaturanDisplay{
+		KdDisplay:       kdDisplay,
+		PanelPerHalaman: 4,
+		IntervalRotasi:  10,
+		WarnaUtama:      "#0d6efd",
+		WarnaLatar:      "#ffffff",
+		WarnaTeks:       "#212529",
+		TampilTerlewat:  true,
+		TampilDokter:    true,
+		SkalaFont:       1,
+		SamaranNama:     models.SamaranPenuh,
+	}
+	db.Where("kd_display = ?", kdDisplay).Limit(1).Find(&pengaturan)
+
+	return pengaturan
+}
+
+// pesanLayoutDisplay membuat pesan WebSocket berisi pengaturan layout display
+func (h *SettingDisplayPoliHandler) pesanLayoutDisplay(kdDisplay string) interface{} {
+	return pesanDisplay{
+		Type:      "layout",
+		KdDisplay: kdDisplay,
+		Data:      getPengaturanDisplay(h.DB, kdDisplay),
+	}
+}
+
+// GetLayoutDisplay mengembalikan pengaturan layout untuk display tertentu
+func (h *SettingDisplayPoliHandler) GetLayoutDisplay(c *gin.Context) {
+	pengaturan := getPengaturanDisplay(h.DB, c.Param("kd_display"))
+	c.JSON(http.StatusOK, pengaturan)
+}
+
+// SimpanLayoutDisplay menyimpan pengaturan layout display dan mengirimkannya ke display yang terhubung.
+// Field yang tidak dikirim tetap menggunakan nilai sebelumnya.
+func (h *SettingDisplayPoliHandler) SimpanLayoutDisplay(c *gin.Context) {
+	kdDisplay := c.Param("kd_display")
+
+	var jumlah int64
+	if err := h.DB.Table("bw_display_poli").Where("kd_display = ?", kdDisplay).Count(&jumlah).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat memeriksa display",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	if jumlah == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "Display tidak ditemukan",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	pengaturan := getPengaturanDisplay(h.DB, kdDisplay)
+
+	if err := c.ShouldBindJSON(&pengaturan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Format pengaturan tidak valid",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	pengaturan.KdDisplay = kdDisplay
+
+	if pengaturan.PanelPerHalaman < 1 || pengaturan.PanelPerHalaman > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Panel per halaman harus antara 1 dan 12",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if pengaturan.IntervalRotasi != 0 && (pengaturan.IntervalRotasi < 3 || pengaturan.IntervalRotasi > 300) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Interval rotasi harus 0 (tanpa rotasi) atau antara 3 dan 300 detik",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	for _, warna := range []string{pengaturan.WarnaUtama, pengaturan.WarnaLatar, pengaturan.WarnaTeks} {
+		if !warnaHexValid(warna) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Warna harus dalam format hex, misalnya #0d6efd",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+	}
+
+	if pengaturan.SkalaFont < 0.5 || pengaturan.SkalaFont > 3 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Skala font harus antara 0.5 dan 3",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if !samaranNamaValid(pengaturan.SamaranNama) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Samaran nama harus penuh, nama_depan, inisial, atau nomor",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if err := h.DB.Save(&pengaturan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan layout display",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	h.Socket.KirimKeDisplay(kdDisplay, h.pesanLayoutDisplay(kdDisplay))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Layout display berhasil disimpan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// warnaHexValid memeriksa format warna hex #rrggbb
+func warnaHexValid(warna string) bool {
+	if len(warna) != 7 || warna[0] != '#' {
+		return false
+	}
+	for _, r := range warna[1:] {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') && (r < 'A' || r > 'F') {
+			return false
+		}
+	}
+	return true
+}
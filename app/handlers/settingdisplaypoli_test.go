@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestDeleteDisplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		perangkat []int64
+		putus     bool
+	}{
+		{name: "perangkat dicabut dan diputus", perangkat: []int64{7}, putus: true},
+		{name: "tanpa perangkat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var baris [][]driver.Value
+			for _, id := range tt.perangkat {
+				baris = append(baris, []driver.Value{id})
+			}
+			db, fake := bukaDatabasePalsu(t, hasilPalsu{
+				memuat: "SELECT `id` FROM `bw_perangkat_display`",
+				kolom:  []string{"id"},
+				baris:  baris,
+			})
+
+			p := &pembangunPalsu{}
+			h := NewSettingDisplayPoliHandler(db)
+			h.Socket = NewDisplaySocketHub(NewDisplaySnapshotCache(p.bangun))
+
+			// Koneksi perangkat 7 yang sedang membuka display
+			conn := &websocket.Conn{}
+			client := &displayClient{conn: conn, kdDisplay: "D1", idPerangkat: 7, kirim: make(chan interface{}, 1)}
+			h.Socket.clients[conn] = client
+
+			r := gin.New()
+			r.DELETE("/api/display/:kd_display", h.DeleteDisplay)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/display/D1", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, ingin %d", w.Code, http.StatusOK)
+			}
+
+			query := fake.Query()
+			cabut := cariQuery(query, "UPDATE `bw_perangkat_display`")
+			hapus := cariQuery(query, "DELETE FROM `bw_display_poli`")
+			if (cabut >= 0) != tt.putus || hapus < 0 {
+				t.Fatalf("perangkat dicabut %v, display dihapus %v: %q", cabut >= 0, hapus >= 0, query)
+			}
+			if tt.putus && !strings.Contains(query[cabut], "status") {
+				t.Fatalf("status perangkat tidak diubah: %s", query[cabut])
+			}
+
+			for _, tabel := range []string{"bw_display_ruang_poli", "bw_jadwal_operasi_display", "bw_pengaturan_display", "bw_playlist_display", "bw_running_text"} {
+				if i := cariQuery(query, "DELETE FROM `"+tabel+"`"); i < 0 || i > hapus {
+					t.Fatalf("data %s tidak dihapus bersama display", tabel)
+				}
+			}
+
+			_, terhubung := h.Socket.clients[conn]
+			if terhubung == tt.putus {
+				t.Fatalf("koneksi perangkat masih terhubung %v, ingin diputus %v", terhubung, tt.putus)
+			}
+		})
+	}
+}
+
+func TestSimpanLayoutDisplay(t *testing.T) {
+	display := hasilPalsu{memuat: "count(*)", kolom: []string{"count"}, baris: [][]driver.Value{{int64(1)}}}
+
+	tests := []struct {
+		name   string
+		hasil  []hasilPalsu
+		body   string
+		status int
+	}{
+		{name: "display ada", hasil: []hasilPalsu{display}, body: `{"panel_per_halaman": 6}`, status: http.StatusOK},
+		{name: "display tidak ada", body: `{"panel_per_halaman": 6}`, status: http.StatusNotFound},
+		{name: "pengaturan tidak valid", hasil: []hasilPalsu{display}, body: `{"panel_per_halaman": 20}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+			h := NewSettingDisplayPoliHandler(db)
+
+			r := gin.New()
+			r.PUT("/api/display/layout/:kd_display", h.SimpanLayoutDisplay)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/display/layout/D1", strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d", w.Code, tt.status)
+			}
+			disimpan := cariQuery(fake.Query(), "`bw_pengaturan_display` SET") >= 0 || cariQuery(fake.Query(), "INSERT INTO `bw_pengaturan_display`") >= 0
+			if disimpan != (tt.status == http.StatusOK) {
+				t.Fatalf("layout disimpan %v: %q", disimpan, fake.Query())
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
 )
 
 // SettingPoliHandler menangani pengaturan poli
@@ -38,10 +42,11 @@ func (h *SettingPoliHandler) GetAllPoli(c *gin.Context) {
 // AddPoli menambahkan poli baru
 func (h *SettingPoliHandler) AddPoli(c *gin.Context) {
 	var input struct {
-		KdRuangPoli       string `form:"kd_ruang_poli" binding:"required"`
-		NamaRuangPoli     string `form:"nama_ruang_poli" binding:"required"`
-		KdDisplay         string `form:"kd_display" binding:"required"`
-		PosisiDisplayPoli string `form:"posisi_display_poli" binding:"required"`
+		KdRuangPoli       string   `form:"kd_ruang_poli" binding:"required"`
+		NamaRuangPoli     string   `form:"nama_ruang_poli" binding:"required"`
+		KdDisplay         []string `form:"kd_display" binding:"required"`          // Boleh lebih dari satu display
+		PosisiDisplayPoli []int    `form:"posisi_display_poli" binding:"required"` // Posisi pada setiap display, berpasangan dengan kd_display
+		PrefixAntrian     string   `form:"prefix_antrian"`
 	}
 
 	if err := c.ShouldBind(&input); err != nil {
@@ -53,14 +58,43 @@ func (h *SettingPoliHandler) AddPoli(c *gin.Context) {
 		return
 	}
 
-	result := h.DB.Table("bw_ruang_poli").Create(map[string]interface{}{
-		"kd_ruang_poli":       input.KdRuangPoli,
-		"nama_ruang_poli":     input.NamaRuangPoli,
-		"kd_display":          input.KdDisplay,
-		"posisi_display_poli": input.PosisiDisplayPoli,
+	input.PrefixAntrian = strings.ToUpper(strings.TrimSpace(input.PrefixAntrian))
+	if !prefixAntrianValid(input.PrefixAntrian) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Prefix antrian maksimal 5 huruf atau angka",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	mapping, err := buatDisplayRuangPoli(input.KdRuangPoli, input.KdDisplay, input.PosisiDisplayPoli)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Display tidak valid: " + err.Error(),
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	// Kolom kd_display dan posisi_display_poli bw_ruang_poli tetap diisi display pertama
+	// untuk kompatibilitas, tampilan display memakai bw_display_ruang_poli
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table("bw_ruang_poli").Create(map[string]interface{}{
+			"kd_ruang_poli":       input.KdRuangPoli,
+			"nama_ruang_poli":     input.NamaRuangPoli,
+			"kd_display":          mapping[0].KdDisplay,
+			"posisi_display_poli": mapping[0].Posisi,
+			"prefix_antrian":      input.PrefixAntrian,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return simpanDisplayRuangPoli(tx, input.KdRuangPoli, mapping)
 	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Terjadi kesalahan saat menambahkan poli",
 			"color":   "danger",
@@ -79,10 +113,11 @@ func (h *SettingPoliHandler) AddPoli(c *gin.Context) {
 // EditPoli mengedit poli yang ada
 func (h *SettingPoliHandler) EditPoli(c *gin.Context) {
 	var input struct {
-		KdRuangPoli       string `form:"kd_ruang_poli" binding:"required"`
-		NamaRuangPoli     string `form:"nama_ruang_poli" binding:"required"`
-		KdDisplay         string `form:"kd_display" binding:"required"`
-		PosisiDisplayPoli string `form:"posisi_display_poli" binding:"required"`
+		KdRuangPoli       string   `form:"kd_ruang_poli" binding:"required"`
+		NamaRuangPoli     string   `form:"nama_ruang_poli" binding:"required"`
+		KdDisplay         []string `form:"kd_display" binding:"required"`          // Boleh lebih dari satu display
+		PosisiDisplayPoli []int    `form:"posisi_display_poli" binding:"required"` // Posisi pada setiap display, berpasangan dengan kd_display
+		PrefixAntrian     *string  `form:"prefix_antrian"`                         // Tidak diubah jika tidak dikirim
 	}
 
 	if err := c.ShouldBind(&input); err != nil {
@@ -94,13 +129,43 @@ func (h *SettingPoliHandler) EditPoli(c *gin.Context) {
 		return
 	}
 
-	result := h.DB.Table("bw_ruang_poli").Where("kd_ruang_poli = ?", input.KdRuangPoli).Updates(map[string]interface{}{
+	mapping, err := buatDisplayRuangPoli(input.KdRuangPoli, input.KdDisplay, input.PosisiDisplayPoli)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Display tidak valid: " + err.Error(),
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	updates := map[string]interface{}{
 		"nama_ruang_poli":     input.NamaRuangPoli,
-		"kd_display":          input.KdDisplay,
-		"posisi_display_poli": input.PosisiDisplayPoli,
+		"kd_display":          mapping[0].KdDisplay,
+		"posisi_display_poli": mapping[0].Posisi,
+	}
+
+	if input.PrefixAntrian != nil {
+		prefix := strings.ToUpper(strings.TrimSpace(*input.PrefixAntrian))
+		if !prefixAntrianValid(prefix) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Prefix antrian maksimal 5 huruf atau angka",
+				"color":   "danger",
+				"icon":    "ban",
+			})
+			return
+		}
+		updates["prefix_antrian"] = prefix
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("bw_ruang_poli").Where("kd_ruang_poli = ?", input.KdRuangPoli).Updates(updates).Error; err != nil {
+			return err
+		}
+		return simpanDisplayRuangPoli(tx, input.KdRuangPoli, mapping)
 	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Terjadi kesalahan saat update poli",
 			"color":   "danger",
@@ -120,9 +185,14 @@ func (h *SettingPoliHandler) EditPoli(c *gin.Context) {
 func (h *SettingPoliHandler) DeletePoli(c *gin.Context) {
 	kdRuangPoli := c.Param("kd_ruang_poli")
 
-	result := h.DB.Table("bw_ruang_poli").Where("kd_ruang_poli = ?", kdRuangPoli).Delete(nil)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := simpanDisplayRuangPoli(tx, kdRuangPoli, nil); err != nil {
+			return err
+		}
+		return tx.Table("bw_ruang_poli").Where("kd_ruang_poli = ?", kdRuangPoli).Delete(nil).Error
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "Terjadi kesalahan saat menghapus poli",
 			"color":   "danger",
@@ -138,6 +208,143 @@ func (h *SettingPoliHandler) DeletePoli(c *gin.Context) {
 	})
 }
 
+// GetPengaturanPoli mengembalikan pengaturan antrian untuk ruang poli tertentu
+func (h *SettingPoliHandler) GetPengaturanPoli(c *gin.Context) {
+	pengaturan := getPengaturanRuangPoli(h.DB, c.Param("kd_ruang_poli"))
+	c.JSON(http.StatusOK, pengaturan)
+}
+
+// SimpanPengaturanPoli menyimpan pengaturan antrian untuk ruang poli tertentu.
+// Field yang tidak dikirim tetap menggunakan nilai sebelumnya.
+func (h *SettingPoliHandler) SimpanPengaturanPoli(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+	pengaturan := getPengaturanRuangPoli(h.DB, kdRuangPoli)
+
+	if err := c.ShouldBindJSON(&pengaturan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Format pengaturan tidak valid",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+	pengaturan.KdRuangPoli = kdRuangPoli
+
+	if pengaturan.MaksPanggilan < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Maksimal panggilan minimal 1",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	switch pengaturan.KebijakanTerlewat {
+	case models.KebijakanTerlewatManual, models.KebijakanTerlewatSetelah, models.KebijakanTerlewatAkhir:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Kebijakan pasien terlewat harus manual, setelah, atau akhir",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if pengaturan.JumlahSisip < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Jumlah sisip tidak boleh negatif",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if pengaturan.BatasPanggilan < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Batas waktu panggilan minimal 1 menit",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if pengaturan.SelangPrioritas < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Selang prioritas tidak boleh negatif",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if !samaranNamaValid(pengaturan.SamaranNama) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Samaran nama harus penuh, nama_depan, inisial, atau nomor",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	if err := h.DB.Save(&pengaturan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "Terjadi kesalahan saat menyimpan pengaturan poli",
+			"color":   "danger",
+			"icon":    "ban",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pengaturan poli berhasil disimpan!",
+		"color":   "success",
+		"icon":    "check",
+	})
+}
+
+// getPengaturanRuangPoli mendapatkan pengaturan antrian ruang poli, atau nilai default jika belum diatur
+func getPengaturanRuangPoli(db *gorm.DB, kdRuangPoli string) models.PengaturanRuangPoli {
+	pengaturan := pengaturanRuangPoliDefault(kdRuangPoli)
+	db.Where("kd_ruang_poli = ?", kdRuangPoli).Limit(1).Find(&pengaturan)
+
+	return pengaturan
+}
+
+// getPengaturanRuangPoliList mendapatkan pengaturan beberapa ruang poli sekaligus dalam satu query,
+// dengan nilai default untuk ruang poli yang belum diatur
+func getPengaturanRuangPoliList(db *gorm.DB, kdRuangPoliList []string) (map[string]models.PengaturanRuangPoli, error) {
+	hasil := make(map[string]models.PengaturanRuangPoli, len(kdRuangPoliList))
+	for _, kd := range kdRuangPoliList {
+		hasil[kd] = pengaturanRuangPoliDefault(kd)
+	}
+	if len(kdRuangPoliList) == 0 {
+		return hasil, nil
+	}
+
+	var tersimpan []models.PengaturanRuangPoli
+	if err := db.Where("kd_ruang_poli IN ?", kdRuangPoliList).Find(&tersimpan).Error; err != nil {
+		return hasil, err
+	}
+	for _, pengaturan := range tersimpan {
+		hasil[pengaturan.KdRuangPoli] = pengaturan
+	}
+
+	return hasil, nil
+}
+
+// pengaturanRuangPoliDefault mengembalikan pengaturan default ruang poli
+func pengaturanRuangPoliDefault(kdRuangPoli string) models.PengaturanRuangPoli {
+	return models.PengaturanRuangPoli{
+		KdRuangPoli:       kdRuangPoli,
+		MaksPanggilan:     services.GetMaksPanggilan(),
+		KebijakanTerlewat: models.KebijakanTerlewatManual,
+		JumlahSisip:       3,
+		BatasPanggilan:    services.GetBatasPanggilan(),
+		SelangPrioritas:   3,
+		SamaranNama:       models.SamaranPenuh,
+	}
+}
+
 // getDisplays mendapatkan daftar display poli
 func (h *SettingPoliHandler) getDisplays() []map[string]interface{} {
 	var results []map[string]interface{}
@@ -148,14 +355,41 @@ func (h *SettingPoliHandler) getDisplays() []map[string]interface{} {
 	return results
 }
 
-// getAllPoli mendapatkan daftar semua poli
+// prefixAntrianValid memeriksa prefix nomor antrian: boleh kosong, maksimal 5 huruf atau angka
+func prefixAntrianValid(prefix string) bool {
+	if len(prefix) > 5 {
+		return false
+	}
+	for _, r := range prefix {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// getAllPoli mendapatkan daftar semua poli beserta display yang menampilkannya
 func (h *SettingPoliHandler) getAllPoli() []map[string]interface{} {
 	var results []map[string]interface{}
 	h.DB.Table("bw_ruang_poli").
-		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, bw_ruang_poli.kd_display, bw_ruang_poli.posisi_display_poli, bw_display_poli.nama_display").
-		Joins("JOIN bw_display_poli ON bw_ruang_poli.kd_display = bw_display_poli.kd_display").
+		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, bw_ruang_poli.prefix_antrian").
+		Order("bw_ruang_poli.kd_ruang_poli asc").
 		Find(&results)
 
+	kdRuangPoliList := make([]string, len(results))
+	for i := range results {
+		kdRuangPoliList[i] = stringValue(results[i]["kd_ruang_poli"])
+	}
+
+	displays := displayRuangPoliList(h.DB, kdRuangPoliList)
+	for i, poli := range results {
+		poliDisplays := displays[kdRuangPoliList[i]]
+		if poliDisplays == nil {
+			poliDisplays = []map[string]interface{}{}
+		}
+		poli["displays"] = poliDisplays
+	}
+
 	return results
 }
 
@@ -216,7 +450,7 @@ func (h *SettingPoliHandler) GetDokterPoli(c *gin.Context) {
 		Select("bw_ruangpoli_dokter.kd_dokter, bw_ruangpoli_dokter.nama_dokter, dokter.jk, bw_ruangpoli_dokter.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, poliklinik.nm_poli").
 		Joins("LEFT JOIN dokter ON bw_ruangpoli_dokter.kd_dokter = dokter.kd_dokter").
 		Joins("LEFT JOIN bw_ruang_poli ON bw_ruangpoli_dokter.kd_ruang_poli = bw_ruang_poli.kd_ruang_poli").
-		Joins("LEFT JOIN jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter").
+		Joins("LEFT JOIN (?) AS jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter", services.QueryJadwalDokter(h.DB)).
 		Joins("LEFT JOIN poliklinik ON jadwal.kd_poli = poliklinik.kd_poli").
 		Where("bw_ruangpoli_dokter.kd_ruang_poli = ?", kdRuangPoli).
 		Order("bw_ruangpoli_dokter.nama_dokter ASC").
@@ -99,7 +99,7 @@ func (h *SettingPosisiDokterHandler) EditPoliDokter(c *gin.Context) {
 func (h *SettingPosisiDokterHandler) getPoli() []map[string]interface{} {
 	var results []map[string]interface{}
 	h.DB.Table("bw_ruang_poli").
-		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli, bw_ruang_poli.kd_display, bw_ruang_poli.posisi_display_poli").
+		Select("bw_ruang_poli.kd_ruang_poli, bw_ruang_poli.nama_ruang_poli").
 		Find(&results)
 
 	return results
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selangCobaUlangSnapshot adalah jeda sebelum snapshot yang gagal dibangun dicoba lagi,
+// agar database yang sedang bermasalah tidak dibanjiri permintaan dari display
+const selangCobaUlangSnapshot = 5 * time.Second
+
+// DisplaySnapshotCache menyimpan snapshot daftar poli per display di memori.
+// Snapshot hanya dibangun ulang jika ada kejadian antrian pada salah satu ruang polinya
+// atau saat penyegaran berkala, sehingga polling display tidak selalu membebani database.
+// Jika pembangunan ulang gagal, snapshot terakhir yang berhasil tetap disajikan dengan tanda basi.
+type DisplaySnapshotCache struct {
+	mu          sync.Mutex
+	bangun      func(kdDisplay string) ([]map[string]interface{}, error)
+	entries     map[string]*snapshotSlot
+	saatBerubah func(kdDisplay []string)
+}
+
+// snapshotSlot menyimpan snapshot satu display. generasi bertambah setiap kali snapshot
+// ditandai berubah; snapshot dengan generasi lebih lama dibangun ulang saat diminta.
+type snapshotSlot struct {
+	bangunMu sync.Mutex // Mencegah snapshot display yang sama dibangun bersamaan
+	generasi int
+	snapshot *DisplaySnapshot // Snapshot terakhir yang berhasil dibangun
+	basi     *DisplaySnapshot // Snapshot yang disajikan setelah pembangunan terakhir gagal
+	gagal    time.Time        // Waktu pembangunan terakhir gagal
+}
+
+// DisplaySnapshot adalah hasil getPoliList untuk satu display beserta JSON dan ETag-nya.
+// Snapshot basi berisi data terakhir yang berhasil (Body nil jika belum pernah berhasil)
+// dengan Err berisi penyebab kegagalan pembangunan terbaru. Err hanya untuk log server dan
+// tidak dikirim ke display.
+type DisplaySnapshot struct {
+	PoliList  []map[string]interface{}
+	Body      []byte
+	ETag      string
+	Dibuat    time.Time
+	Basi      bool
+	Err       error
+	generasi  int
+	ruangPoli map[string]bool
+}
+
+// NewDisplaySnapshotCache membuat instance baru dari DisplaySnapshotCache dengan fungsi pembangun snapshot
+func NewDisplaySnapshotCache(bangun func(kdDisplay string) ([]map[string]interface{}, error)) *DisplaySnapshotCache {
+	return &DisplaySnapshotCache{
+		bangun:  bangun,
+		entries: make(map[string]*snapshotSlot),
+	}
+}
+
+// SaatBerubah menetapkan fungsi yang dipanggil dengan kode display yang snapshot-nya ditandai berubah.
+// Fungsi dipanggil di luar kunci cache dan tidak boleh lama.
+func (s *DisplaySnapshotCache) SaatBerubah(fn func(kdDisplay []string)) {
+	s.mu.Lock()
+	s.saatBerubah = fn
+	s.mu.Unlock()
+}
+
+// Ambil mengembalikan snapshot display, membangunnya ulang jika belum ada atau sudah ditandai berubah.
+// Jika pembangunan gagal, snapshot basi dikembalikan dan data lama tidak ditimpa.
+func (s *DisplaySnapshotCache) Ambil(kdDisplay string) *DisplaySnapshot {
+	s.mu.Lock()
+	slot, ok := s.entries[kdDisplay]
+	if !ok {
+		slot = &snapshotSlot{}
+		s.entries[kdDisplay] = slot
+	}
+	s.mu.Unlock()
+
+	slot.bangunMu.Lock()
+	defer slot.bangunMu.Unlock()
+
+	s.mu.Lock()
+	generasi := slot.generasi
+	snapshot := slot.snapshot
+	basi := slot.basi
+	gagal := slot.gagal
+	s.mu.Unlock()
+
+	if snapshot != nil && snapshot.generasi == generasi {
+		return snapshot
+	}
+	if basi != nil && time.Since(gagal) < selangCobaUlangSnapshot {
+		return basi
+	}
+
+	poliList, err := s.bangun(kdDisplay)
+	var body []byte
+	if err == nil {
+		body, err = json.Marshal(poliList)
+	}
+	if err != nil {
+		log.Printf("Gagal membuat snapshot display %s: %v", kdDisplay, err)
+		basi = snapshotBasi(snapshot, err)
+
+		s.mu.Lock()
+		slot.basi = basi
+		slot.gagal = time.Now()
+		s.mu.Unlock()
+
+		return basi
+	}
+	hash := sha256.Sum256(body)
+
+	snapshot = &DisplaySnapshot{
+		PoliList:  poliList,
+		Body:      body,
+		ETag:      `"` + hex.EncodeToString(hash[:16]) + `"`,
+		Dibuat:    time.Now(),
+		generasi:  generasi,
+		ruangPoli: make(map[string]bool, len(poliList)),
+	}
+	for _, poli := range poliList {
+		snapshot.ruangPoli[fmt.Sprint(poli["kd_ruang_poli"])] = true
+	}
+
+	// Kejadian yang terjadi selama pembangunan sudah menaikkan generasi,
+	// sehingga snapshot ini akan dibangun ulang pada permintaan berikutnya
+	s.mu.Lock()
+	slot.snapshot = snapshot
+	slot.basi = nil
+	s.mu.Unlock()
+
+	return snapshot
+}
+
+// snapshotBasi membuat snapshot basi dari snapshot terakhir yang berhasil, jika ada.
+// ETag dibedakan agar client yang menyimpan data segar tidak menerima 304 untuk data basi.
+func snapshotBasi(terakhir *DisplaySnapshot, err error) *DisplaySnapshot {
+	basi := &DisplaySnapshot{
+		Dibuat: time.Now(),
+		Basi:   true,
+		Err:    err,
+	}
+	if terakhir != nil {
+		basi.PoliList = terakhir.PoliList
+		basi.Body = terakhir.Body
+		basi.ETag = strings.TrimSuffix(terakhir.ETag, `"`) + `-basi"`
+		basi.Dibuat = terakhir.Dibuat
+		basi.generasi = terakhir.generasi
+		basi.ruangPoli = terakhir.ruangPoli
+	}
+	return basi
+}
+
+// TandaiBerubah menandai snapshot display yang menampilkan ruang poli tersebut agar dibangun ulang
+func (s *DisplaySnapshotCache) TandaiBerubah(kdRuangPoli ...string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	var berubah []string
+	for kdDisplay, slot := range s.entries {
+		if slot.snapshot == nil {
+			continue
+		}
+		for _, kd := range kdRuangPoli {
+			if slot.snapshot.ruangPoli[kd] {
+				slot.generasi++
+				berubah = append(berubah, kdDisplay)
+				break
+			}
+		}
+	}
+	saatBerubah := s.saatBerubah
+	s.mu.Unlock()
+
+	if saatBerubah != nil && len(berubah) > 0 {
+		saatBerubah(berubah)
+	}
+}
+
+// TandaiSemuaBerubah menandai semua snapshot display agar dibangun ulang
+func (s *DisplaySnapshotCache) TandaiSemuaBerubah() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	berubah := make([]string, 0, len(s.entries))
+	for kdDisplay, slot := range s.entries {
+		slot.generasi++
+		berubah = append(berubah, kdDisplay)
+	}
+	saatBerubah := s.saatBerubah
+	s.mu.Unlock()
+
+	if saatBerubah != nil && len(berubah) > 0 {
+		saatBerubah(berubah)
+	}
+}
+
+// MulaiPenyegaran menandai semua snapshot berubah secara berkala agar pendaftaran pasien baru
+// dari Khanza ikut tampil di display
+func (s *DisplaySnapshotCache) MulaiPenyegaran(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.TandaiSemuaBerubah()
+	}
+}
+
+// Middleware mengembalikan gin middleware yang menandai semua snapshot berubah setelah
+// permintaan berhasil. Dipakai pada rute pengaturan yang dapat mengubah isi display.
+func (s *DisplaySnapshotCache) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Request.Method != http.MethodGet && c.Writer.Status() < http.StatusBadRequest {
+			s.TandaiSemuaBerubah()
+		}
+	}
+}
+
+// etagCocok memeriksa apakah header If-None-Match memuat ETag snapshot
+func etagCocok(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pembangunPalsu adalah fungsi pembangun snapshot yang hasilnya dapat diatur per pemanggilan
+type pembangunPalsu struct {
+	jumlah int
+	nama   string
+	err    error
+}
+
+func (p *pembangunPalsu) bangun(kdDisplay string) ([]map[string]interface{}, error) {
+	p.jumlah++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []map[string]interface{}{{"kd_ruang_poli": "R1", "nama": p.nama}}, nil
+}
+
+// kedaluwarsakanPercobaan membuat pembangunan snapshot yang gagal boleh segera dicoba lagi
+func kedaluwarsakanPercobaan(s *DisplaySnapshotCache, kdDisplay string) {
+	s.mu.Lock()
+	s.entries[kdDisplay].gagal = time.Now().Add(-selangCobaUlangSnapshot)
+	s.mu.Unlock()
+}
+
+func TestDisplaySnapshotCache(t *testing.T) {
+	errDB := errors.New("dial tcp 10.0.0.5:3306: connection refused")
+
+	tests := []struct {
+		name string
+		uji  func(t *testing.T, s *DisplaySnapshotCache, p *pembangunPalsu)
+	}{
+		{
+			name: "snapshot dipakai ulang sampai ditandai berubah",
+			uji: func(t *testing.T, s *DisplaySnapshotCache, p *pembangunPalsu) {
+				pertama := s.Ambil("D1")
+				kedua := s.Ambil("D1")
+				if p.jumlah != 1 || pertama != kedua {
+					t.Fatalf("dibangun %d kali, ingin 1", p.jumlah)
+				}
+
+				s.TandaiBerubah("R2")
+				s.Ambil("D1")
+				if p.jumlah != 1 {
+					t.Fatalf("ruang poli lain membangun ulang snapshot")
+				}
+
+				s.TandaiBerubah("R1")
+				ketiga := s.Ambil("D1")
+				if p.jumlah != 2 {
+					t.Fatalf("dibangun %d kali, ingin 2", p.jumlah)
+				}
+				if ketiga.ETag != pertama.ETag {
+					t.Fatalf("ETag berubah untuk data yang sama: %s, %s", pertama.ETag, ketiga.ETag)
+				}
+
+				p.nama = "baru"
+				s.TandaiSemuaBerubah()
+				if keempat := s.Ambil("D1"); keempat.ETag == pertama.ETag {
+					t.Fatalf("ETag tidak berubah untuk data baru")
+				}
+			},
+		},
+		{
+			name: "gagal setelah berhasil menyajikan data terakhir sebagai basi",
+			uji: func(t *testing.T, s *DisplaySnapshotCache, p *pembangunPalsu) {
+				segar := s.Ambil("D1")
+
+				p.err = errDB
+				s.TandaiSemuaBerubah()
+				basi := s.Ambil("D1")
+				if !basi.Basi || string(basi.Body) != string(segar.Body) {
+					t.Fatalf("snapshot basi %v dengan body %s, ingin body terakhir", basi.Basi, basi.Body)
+				}
+				if basi.ETag == segar.ETag {
+					t.Fatalf("ETag basi sama dengan ETag segar")
+				}
+
+				// Selama jeda coba ulang, database tidak dibebani lagi
+				s.Ambil("D1")
+				if p.jumlah != 2 {
+					t.Fatalf("dibangun %d kali selama jeda coba ulang, ingin 2", p.jumlah)
+				}
+
+				p.err = nil
+				kedaluwarsakanPercobaan(s, "D1")
+				if pulih := s.Ambil("D1"); pulih.Basi || pulih.ETag != segar.ETag {
+					t.Fatalf("snapshot tidak pulih setelah database kembali")
+				}
+			},
+		},
+		{
+			name: "gagal sebelum pernah berhasil tanpa body",
+			uji: func(t *testing.T, s *DisplaySnapshotCache, p *pembangunPalsu) {
+				p.err = errDB
+				if snapshot := s.Ambil("D1"); snapshot.Body != nil || !snapshot.Basi {
+					t.Fatalf("snapshot %+v, ingin basi tanpa body", snapshot)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pembangunPalsu{nama: "lama"}
+			tt.uji(t, NewDisplaySnapshotCache(p.bangun), p)
+		})
+	}
+}
+
+func TestGetPoliListByDisplay(t *testing.T) {
+	errDB := errors.New("dial tcp 10.0.0.5:3306: connection refused")
+
+	tests := []struct {
+		name        string
+		siapkan     func(s *DisplaySnapshotCache, p *pembangunPalsu)
+		ifNoneMatch bool
+		status      int
+		basi        bool
+	}{
+		{name: "data segar", status: http.StatusOK},
+		{name: "ETag cocok", ifNoneMatch: true, status: http.StatusNotModified},
+		{
+			name: "database gagal setelah berhasil",
+			siapkan: func(s *DisplaySnapshotCache, p *pembangunPalsu) {
+				s.Ambil("D1")
+				p.err = errDB
+				s.TandaiSemuaBerubah()
+			},
+			status: http.StatusOK,
+			basi:   true,
+		},
+		{
+			name:    "database gagal sejak awal",
+			siapkan: func(s *DisplaySnapshotCache, p *pembangunPalsu) { p.err = errDB },
+			status:  http.StatusServiceUnavailable,
+			basi:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pembangunPalsu{nama: "lama"}
+			h := &DisplayPoliHandler{Snapshot: NewDisplaySnapshotCache(p.bangun)}
+			if tt.siapkan != nil {
+				tt.siapkan(h.Snapshot, p)
+			}
+
+			r := gin.New()
+			r.GET("/api/display/poli/:kd_display", h.GetPoliListByDisplay)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/display/poli/D1", nil)
+			if tt.ifNoneMatch {
+				req.Header.Set("If-None-Match", h.Snapshot.Ambil("D1").ETag)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, ingin %d", w.Code, tt.status)
+			}
+			if w.Code == http.StatusNotModified {
+				return
+			}
+			if strings.Contains(w.Body.String(), "10.0.0.5") {
+				t.Fatalf("response memuat error database: %s", w.Body.String())
+			}
+
+			var body struct {
+				Basi bool `json:"basi"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Basi != tt.basi {
+				t.Fatalf("basi %v, ingin %v", body.Basi, tt.basi)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// StatusDokterHandler menangani status kehadiran dokter yang diatur perawat
+type StatusDokterHandler struct {
+	DB       *gorm.DB
+	Snapshot *DisplaySnapshotCache // Snapshot display yang ditandai berubah saat status dokter diubah
+}
+
+// NewStatusDokterHandler membuat instance baru dari StatusDokterHandler
+func NewStatusDokterHandler(db *gorm.DB) *StatusDokterHandler {
+	return &StatusDokterHandler{DB: db}
+}
+
+// SetSnapshotCache menetapkan cache snapshot display untuk handler ini
+func (h *StatusDokterHandler) SetSnapshotCache(snapshot *DisplaySnapshotCache) {
+	h.Snapshot = snapshot
+}
+
+// statusDokterValid memeriksa status kehadiran dokter
+func statusDokterValid(status string) bool {
+	switch status {
+	case models.StatusDokterBelumDatang, models.StatusDokterPraktik, models.StatusDokterIstirahat, models.StatusDokterSelesai:
+		return true
+	}
+	return false
+}
+
+// jadwalDokterRuangPoli mengambil dokter beberapa ruang poli yang berpraktek hari ini beserta jadwal
+// dan statusnya, dikelompokkan per ruang poli dan diurutkan sesuai jam mulai
+func jadwalDokterRuangPoli(db *gorm.DB, kdRuangPoliList []string) (map[string][]map[string]interface{}, error) {
+	hasil := make(map[string][]map[string]interface{}, len(kdRuangPoliList))
+	if len(kdRuangPoliList) == 0 {
+		return hasil, nil
+	}
+
+	hari := services.GetDayList()[time.Now().Format("Monday")]
+
+	var jadwal []map[string]interface{}
+	err := db.Table("bw_ruangpoli_dokter").
+		Select("bw_ruangpoli_dokter.kd_ruang_poli, bw_ruangpoli_dokter.kd_dokter, bw_ruangpoli_dokter.nama_dokter, jadwal.jam_mulai, jadwal.jam_selesai").
+		Joins("JOIN (?) AS jadwal ON bw_ruangpoli_dokter.kd_dokter = jadwal.kd_dokter", services.QueryJadwalDokter(db)).
+		Where("jadwal.hari_kerja = ? AND bw_ruangpoli_dokter.kd_ruang_poli IN ?", hari, kdRuangPoliList).
+		Order("bw_ruangpoli_dokter.kd_ruang_poli asc").
+		Order("jadwal.jam_mulai asc").
+		Find(&jadwal).Error
+	if err != nil {
+		return hasil, err
+	}
+	if len(jadwal) == 0 {
+		return hasil, nil
+	}
+
+	kdDokterList := make([]string, 0, len(jadwal))
+	for _, j := range jadwal {
+		kdDokterList = append(kdDokterList, stringValue(j["kd_dokter"]))
+	}
+
+	var statusList []models.StatusDokter
+	err = db.Where("kd_dokter IN ? AND tanggal = ?", kdDokterList, awalHariIni().Format("2006-01-02")).
+		Find(&statusList).Error
+	if err != nil {
+		return hasil, err
+	}
+	status := make(map[string]*models.StatusDokter, len(statusList))
+	for i := range statusList {
+		status[statusList[i].KdDokter] = &statusList[i]
+	}
+
+	sekarang := time.Now()
+	for _, j := range jadwal {
+		kd := stringValue(j["kd_ruang_poli"])
+		hasil[kd] = append(hasil[kd], infoDokter(j, status[stringValue(j["kd_dokter"])], sekarang))
+	}
+	return hasil, nil
+}
+
+// infoDokter menyusun jadwal dan status dokter hari ini beserta keterlambatannya
+func infoDokter(jadwal map[string]interface{}, status *models.StatusDokter, sekarang time.Time) map[string]interface{} {
+	info := map[string]interface{}{
+		"kd_dokter":       jadwal["kd_dokter"],
+		"nama_dokter":     jadwal["nama_dokter"],
+		"jam_mulai":       jadwal["jam_mulai"],
+		"jam_selesai":     jadwal["jam_selesai"],
+		"status":          models.StatusDokterBelumDatang,
+		"keterangan":      "",
+		"jam_datang":      nil,
+		"terlambat_menit": 0,
+	}
+
+	mulai := jamHariIni(jadwal["jam_mulai"])
+	selesai := jamHariIni(jadwal["jam_selesai"])
+
+	var terlambat time.Duration
+	if status != nil {
+		info["status"] = status.Status
+		info["keterangan"] = status.Keterangan
+		if status.JamDatang != nil {
+			info["jam_datang"] = status.JamDatang.Format("15:04")
+			terlambat = status.JamDatang.Sub(mulai)
+		}
+	}
+
+	// Dokter yang belum datang dihitung terlambat sejak jam mulai sampai jam selesai praktek
+	if info["status"] == models.StatusDokterBelumDatang && (status == nil || status.JamDatang == nil) &&
+		sekarang.After(mulai) && (selesai.IsZero() || sekarang.Before(selesai)) {
+		terlambat = sekarang.Sub(mulai)
+	}
+
+	if !mulai.IsZero() && terlambat > 0 {
+		info["terlambat_menit"] = int(terlambat.Minutes())
+	}
+	return info
+}
+
+// dokterAktif memilih dokter yang ditampilkan pada panel ruang poli: dokter yang sedang praktek
+// atau istirahat, selain itu jadwal berikutnya yang belum selesai, atau jadwal terakhir hari ini
+func dokterAktif(dokterList []map[string]interface{}, sekarang time.Time) map[string]interface{} {
+	if len(dokterList) == 0 {
+		return nil
+	}
+
+	for _, dokter := range dokterList {
+		if dokter["status"] == models.StatusDokterPraktik || dokter["status"] == models.StatusDokterIstirahat {
+			return dokter
+		}
+	}
+	for _, dokter := range dokterList {
+		selesai := jamHariIni(dokter["jam_selesai"])
+		if dokter["status"] != models.StatusDokterSelesai && (selesai.IsZero() || sekarang.Before(selesai)) {
+			return dokter
+		}
+	}
+	return dokterList[len(dokterList)-1]
+}
+
+// GetStatusDokter mengembalikan dokter ruang poli yang berpraktek hari ini beserta statusnya
+func (h *StatusDokterHandler) GetStatusDokter(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	jadwal, err := jadwalDokterRuangPoli(h.DB, []string{kdRuangPoli})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengambil status dokter: " + err.Error(),
+		})
+		return
+	}
+
+	dokterList := jadwal[kdRuangPoli]
+	if dokterList == nil {
+		dokterList = []map[string]interface{}{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"dokter_aktif": dokterAktif(dokterList, time.Now()),
+			"dokter":       dokterList,
+		},
+	})
+}
+
+// UbahStatusDokter mengubah status kehadiran dokter pada ruang poli.
+// Tanpa kd_dokter, status diterapkan pada dokter yang sedang ditampilkan di panel ruang poli.
+func (h *StatusDokterHandler) UbahStatusDokter(c *gin.Context) {
+	kdRuangPoli := c.Param("kd_ruang_poli")
+
+	var input struct {
+		KdDokter   string `json:"kd_dokter"`
+		Status     string `json:"status" binding:"required"`
+		Keterangan string `json:"keterangan"`
+		Petugas    string `json:"petugas"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || !statusDokterValid(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Status harus belum_datang, praktik, istirahat, atau selesai",
+		})
+		return
+	}
+
+	if input.KdDokter == "" {
+		jadwal, err := jadwalDokterRuangPoli(h.DB, []string{kdRuangPoli})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Gagal mengambil jadwal dokter: " + err.Error(),
+			})
+			return
+		}
+		if aktif := dokterAktif(jadwal[kdRuangPoli], time.Now()); aktif != nil {
+			input.KdDokter = stringValue(aktif["kd_dokter"])
+		}
+	}
+
+	var status models.StatusDokter
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var jumlah int64
+		err := tx.Table("bw_ruangpoli_dokter").
+			Where("kd_dokter = ? AND kd_ruang_poli = ?", input.KdDokter, kdRuangPoli).
+			Count(&jumlah).Error
+		if err != nil {
+			return err
+		}
+		if input.KdDokter == "" || jumlah == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		hariIni := awalHariIni()
+		err = tx.Where("kd_dokter = ? AND tanggal = ?", input.KdDokter, hariIni.Format("2006-01-02")).
+			Limit(1).Find(&status).Error
+		if err != nil {
+			return err
+		}
+
+		sekarang := time.Now()
+		status.KdDokter = input.KdDokter
+		status.Tanggal = hariIni
+		status.Status = input.Status
+		status.Keterangan = input.Keterangan
+		status.Petugas = input.Petugas
+		status.Diubah = sekarang
+
+		// Jam datang dicatat sekali saat dokter pertama kali mulai praktek
+		if input.Status == models.StatusDokterPraktik && status.JamDatang == nil {
+			status.JamDatang = &sekarang
+		}
+		if input.Status == models.StatusDokterBelumDatang {
+			status.JamDatang = nil
+		}
+
+		return tx.Save(&status).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Dokter tidak terdaftar pada ruang poli ini",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Gagal mengubah status dokter: " + err.Error(),
+		})
+		return
+	}
+	h.Snapshot.TandaiBerubah(kdRuangPoli)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"data":    status,
+		"message": "Status dokter berhasil diubah",
+	})
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/dhiafahmig/Go-DisplayPoli/app/services"
+)
+
+// barisJadwalDokter adalah satu baris bw_jadwal_dokter beserta nama dokter dan poli
+type barisJadwalDokter struct {
+	KdDokter   string `json:"kd_dokter"`
+	NmDokter   string `json:"nm_dokter"`
+	HariKerja  string `json:"hari_kerja"`
+	JamMulai   string `json:"jam_mulai"`
+	JamSelesai string `json:"jam_selesai"`
+	KdPoli     string `json:"kd_poli"`
+	NmPoli     string `json:"nm_poli"`
+}
+
+// hariKerjaValid memeriksa nama hari kerja sesuai services.GetDayList
+func hariKerjaValid(hari string) bool {
+	for _, h := range services.GetDayList() {
+		if h == hari {
+			return true
+		}
+	}
+	return false
+}
+
+// normalisasiJam mengubah jam berformat HH:MM atau HH:MM:SS menjadi HH:MM:SS
+func normalisasiJam(jam string) (string, bool) {
+	for _, format := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(format, strings.TrimSpace(jam)); err == nil {
+			return t.Format("15:04:05"), true
+		}
+	}
+	return "", false
+}
+
+// errJadwalLokalTidakDitemukan dikembalikan saat jadwal yang diubah tidak ada di bw_jadwal_dokter
+var errJadwalLokalTidakDitemukan = errors.New("jadwal lokal tidak ditemukan")
+
+// queryJadwalTerpakai membangun subquery jadwal yang dipakai display (services.QueryJadwalDokter) ditambah
+// seluruh bw_jadwal_dokter, sehingga jadwal baru tidak bertumpuk dengan jadwal Khanza maupun jadwal lokal
+// walaupun SUMBER_JADWAL tidak memuat lokal
+func queryJadwalTerpakai(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT * FROM (?) AS efektif UNION "+
+			"SELECT j.kd_dokter, j.hari_kerja, j.jam_mulai, j.jam_selesai, j.kd_poli, ? AS sumber FROM bw_jadwal_dokter AS j",
+			services.QueryJadwalDokter(db), services.SumberJadwalLokal)
+}
+
+// validasiJadwalDokter memeriksa hari, jam, dan poli jadwal dokter serta memastikan dokter tidak memiliki
+// jadwal lain yang bertumpuk pada hari yang sama, baik pada sumber jadwal yang dikonfigurasi maupun di
+// bw_jadwal_dokter. Hari dan jam pada jadwal diseragamkan. lama adalah jadwal lokal yang sedang diubah
+// sehingga tidak dianggap bentrok, nil saat menambah. Harus dipanggil di dalam transaksi yang juga menyimpan
+// jadwal: baris bw_jadwal_dokter dokter pada hari tersebut dikunci agar dua permintaan bersamaan tidak
+// sama-sama lolos pemeriksaan. Mengembalikan pesan kesalahan per field, kosong jika jadwal valid.
+func validasiJadwalDokter(tx *gorm.DB, jadwal *barisJadwalDokter, lama *barisJadwalDokter) (map[string]string, error) {
+	galat := make(map[string]string)
+
+	jadwal.HariKerja = strings.ToUpper(strings.TrimSpace(jadwal.HariKerja))
+	if !hariKerjaValid(jadwal.HariKerja) {
+		galat["hari_kerja"] = "Hari kerja harus salah satu dari SENIN, SELASA, RABU, KAMIS, JUMAT, SABTU, atau AKHAD"
+	}
+
+	mulai, mulaiValid := normalisasiJam(jadwal.JamMulai)
+	if !mulaiValid {
+		galat["jam_mulai"] = "Jam mulai harus dalam format HH:MM"
+	}
+	selesai, selesaiValid := normalisasiJam(jadwal.JamSelesai)
+	if !selesaiValid {
+		galat["jam_selesai"] = "Jam selesai harus dalam format HH:MM"
+	}
+	if mulaiValid && selesaiValid && mulai >= selesai {
+		galat["jam_selesai"] = "Jam selesai harus setelah jam mulai"
+	}
+
+	if jadwal.KdPoli != "" {
+		var jumlah int64
+		if err := tx.Table("poliklinik").Where("kd_poli = ?", jadwal.KdPoli).Count(&jumlah).Error; err != nil {
+			return nil, err
+		}
+		if jumlah == 0 {
+			galat["kd_poli"] = "Poli tidak ditemukan"
+		}
+	}
+	if len(galat) > 0 {
+		return galat, nil
+	}
+	jadwal.JamMulai = mulai
+	jadwal.JamSelesai = selesai
+
+	// Kunci jadwal lokal dokter pada hari ini sampai transaksi selesai
+	var terkunci []string
+	err := tx.Table("bw_jadwal_dokter").
+		Where("kd_dokter = ? AND hari_kerja = ?", jadwal.KdDokter, jadwal.HariKerja).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Pluck("kd_dokter", &terkunci).Error
+	if err != nil {
+		return nil, err
+	}
+
+	query := tx.Table("(?) AS jadwal", queryJadwalTerpakai(tx)).
+		Select("jadwal.kd_dokter, jadwal.hari_kerja, jadwal.jam_mulai, jadwal.jam_selesai, jadwal.kd_poli, poliklinik.nm_poli").
+		Joins("LEFT JOIN poliklinik ON jadwal.kd_poli = poliklinik.kd_poli").
+		Where("jadwal.kd_dokter = ? AND jadwal.hari_kerja = ?", jadwal.KdDokter, jadwal.HariKerja).
+		Where("jadwal.jam_mulai < ? AND jadwal.jam_selesai > ?", selesai, mulai)
+	if lama != nil {
+		query = query.Where("NOT (jadwal.sumber = ? AND jadwal.hari_kerja = ? AND jadwal.jam_mulai = ? AND jadwal.jam_selesai = ?)",
+			services.SumberJadwalLokal, lama.HariKerja, lama.JamMulai, lama.JamSelesai)
+	}
+
+	var bentrok []barisJadwalDokter
+	if err := query.Order("jadwal.jam_mulai asc").Find(&bentrok).Error; err != nil {
+		return nil, err
+	}
+	if len(bentrok) > 0 {
+		b := bentrok[0]
+		poli := b.NmPoli
+		if poli == "" {
+			poli = b.KdPoli
+		}
+		galat["jam_mulai"] = "Dokter sudah memiliki jadwal di " + poli + " pukul " + b.JamMulai + "-" + b.JamSelesai
+	}
+	return galat, nil
+}
+
+// responsJadwalTidakValid mengirim pesan kesalahan validasi jadwal per field
+func responsJadwalTidakValid(c *gin.Context, galat map[string]string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Jadwal tidak valid",
+		"errors": galat,
+	})
+}
+
+// GetBentrokJadwal memeriksa seluruh bw_jadwal_dokter dan mengembalikan jadwal dengan hari atau jam
+// yang tidak valid serta pasangan jadwal dokter yang bertumpuk pada hari yang sama
+func (h *JadwalDokterHandler) GetBentrokJadwal(c *gin.Context) {
+	var jadwal []barisJadwalDokter
+	err := h.DB.Table("bw_jadwal_dokter").
+		Select("bw_jadwal_dokter.kd_dokter, dokter.nm_dokter, bw_jadwal_dokter.hari_kerja, bw_jadwal_dokter.jam_mulai, " +
+			"bw_jadwal_dokter.jam_selesai, bw_jadwal_dokter.kd_poli, poliklinik.nm_poli").
+		Joins("LEFT JOIN dokter ON bw_jadwal_dokter.kd_dokter = dokter.kd_dokter").
+		Joins("LEFT JOIN poliklinik ON bw_jadwal_dokter.kd_poli = poliklinik.kd_poli").
+		Order("bw_jadwal_dokter.kd_dokter asc").
+		Order("bw_jadwal_dokter.hari_kerja asc").
+		Order("bw_jadwal_dokter.jam_mulai asc").
+		Find(&jadwal).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	masalah := []gin.H{}
+	perDokterHari := make(map[string][]barisJadwalDokter)
+	var kunciList []string
+
+	for _, j := range jadwal {
+		mulai, mulaiValid := normalisasiJam(j.JamMulai)
+		selesai, selesaiValid := normalisasiJam(j.JamSelesai)
+
+		switch {
+		case !hariKerjaValid(j.HariKerja):
+			masalah = append(masalah, gin.H{
+				"jenis":      "hari_tidak_valid",
+				"keterangan": "Hari kerja " + j.HariKerja + " tidak dikenal",
+				"jadwal":     []barisJadwalDokter{j},
+			})
+			continue
+		case !mulaiValid || !selesaiValid || mulai >= selesai:
+			masalah = append(masalah, gin.H{
+				"jenis":      "jam_tidak_valid",
+				"keterangan": "Jam mulai harus sebelum jam selesai",
+				"jadwal":     []barisJadwalDokter{j},
+			})
+			continue
+		}
+
+		j.JamMulai = mulai
+		j.JamSelesai = selesai
+		kunci := j.KdDokter + "|" + j.HariKerja
+		if _, ada := perDokterHari[kunci]; !ada {
+			kunciList = append(kunciList, kunci)
+		}
+		perDokterHari[kunci] = append(perDokterHari[kunci], j)
+	}
+
+	// Jadwal yang sudah diurutkan per jam mulai bertumpuk dengan jadwal berikutnya yang dimulai sebelum ia selesai
+	for _, kunci := range kunciList {
+		list := perDokterHari[kunci]
+		sort.SliceStable(list, func(a, b int) bool { return list[a].JamMulai < list[b].JamMulai })
+
+		for i := range list {
+			for k := i + 1; k < len(list) && list[k].JamMulai < list[i].JamSelesai; k++ {
+				keterangan := "Jadwal dokter bertumpuk"
+				if list[i].KdPoli != list[k].KdPoli {
+					keterangan = "Dokter dijadwalkan di dua poli pada waktu yang sama"
+				}
+				masalah = append(masalah, gin.H{
+					"jenis":      "bentrok",
+					"keterangan": keterangan,
+					"jadwal":     []barisJadwalDokter{list[i], list[k]},
+				})
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, masalah)
+}
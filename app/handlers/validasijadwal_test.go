@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestValidasiJadwalDokter(t *testing.T) {
+	poliAda := hasilPalsu{memuat: "FROM `poliklinik`", kolom: []string{"count(*)"}, baris: [][]driver.Value{{int64(1)}}}
+	bentrokKhanza := hasilPalsu{
+		memuat: "AS efektif",
+		kolom:  []string{"kd_dokter", "hari_kerja", "jam_mulai", "jam_selesai", "kd_poli", "nm_poli"},
+		baris:  [][]driver.Value{{"D001", "SENIN", "08:00:00", "12:00:00", "ANA", "Poli Anak"}},
+	}
+
+	tests := []struct {
+		name       string
+		jadwal     barisJadwalDokter
+		lama       *barisJadwalDokter
+		hasil      []hasilPalsu
+		galat      []string // Field yang harus memiliki pesan kesalahan
+		tanpaKunci bool     // Jadwal tidak valid ditolak sebelum mengunci jadwal dokter
+	}{
+		{
+			name:   "valid dan diseragamkan",
+			jadwal: barisJadwalDokter{KdDokter: "D001", HariKerja: " senin ", JamMulai: "13:00", JamSelesai: "15:30", KdPoli: "ANA"},
+			hasil:  []hasilPalsu{poliAda},
+		},
+		{
+			name:       "hari tidak dikenal",
+			jadwal:     barisJadwalDokter{KdDokter: "D001", HariKerja: "MINGGU", JamMulai: "13:00", JamSelesai: "15:00", KdPoli: "ANA"},
+			hasil:      []hasilPalsu{poliAda},
+			galat:      []string{"hari_kerja"},
+			tanpaKunci: true,
+		},
+		{
+			name:       "format jam salah",
+			jadwal:     barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "jam 1", JamSelesai: "25:00", KdPoli: "ANA"},
+			hasil:      []hasilPalsu{poliAda},
+			galat:      []string{"jam_mulai", "jam_selesai"},
+			tanpaKunci: true,
+		},
+		{
+			name:       "jam selesai sebelum jam mulai",
+			jadwal:     barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "15:00", JamSelesai: "13:00", KdPoli: "ANA"},
+			hasil:      []hasilPalsu{poliAda},
+			galat:      []string{"jam_selesai"},
+			tanpaKunci: true,
+		},
+		{
+			name:       "poli tidak ditemukan",
+			jadwal:     barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "13:00", JamSelesai: "15:00", KdPoli: "XXX"},
+			galat:      []string{"kd_poli"},
+			tanpaKunci: true,
+		},
+		{
+			name:   "bertumpuk dengan jadwal sumber yang dikonfigurasi",
+			jadwal: barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "11:00", JamSelesai: "14:00", KdPoli: "ANA"},
+			hasil:  []hasilPalsu{poliAda, bentrokKhanza},
+			galat:  []string{"jam_mulai"},
+		},
+		{
+			name:   "mengubah jadwal tanpa poli",
+			jadwal: barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "09:00", JamSelesai: "12:00"},
+			lama:   &barisJadwalDokter{KdDokter: "D001", HariKerja: "SENIN", JamMulai: "08:00:00", JamSelesai: "12:00:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SUMBER_JADWAL", "khanza")
+			db, fake := bukaDatabasePalsu(t, tt.hasil...)
+
+			jadwal := tt.jadwal
+			galat, err := validasiJadwalDokter(db, &jadwal, tt.lama)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(galat) != len(tt.galat) {
+				t.Fatalf("galat %v, ingin field %v", galat, tt.galat)
+			}
+			for _, field := range tt.galat {
+				if galat[field] == "" {
+					t.Fatalf("galat %v, ingin field %s", galat, field)
+				}
+			}
+			if len(galat) == 0 && (jadwal.HariKerja != "SENIN" || len(jadwal.JamMulai) != len("15:04:05")) {
+				t.Fatalf("jadwal tidak diseragamkan: %+v", jadwal)
+			}
+
+			// Jadwal dokter dikunci sebelum bentrok diperiksa pada sumber Khanza dan jadwal lokal
+			var kunci, periksa = -1, -1
+			for i, q := range fake.Query() {
+				switch {
+				case strings.Contains(q, "FROM `bw_jadwal_dokter`") && strings.HasSuffix(q, "FOR UPDATE"):
+					kunci = i
+				case strings.Contains(q, "AS efektif"):
+					periksa = i
+					if !strings.Contains(q, "FROM jadwal AS j") || !strings.Contains(q, "FROM bw_jadwal_dokter AS j") {
+						t.Fatalf("bentrok tidak diperiksa pada sumber jadwal: %s", q)
+					}
+				}
+			}
+			if tt.tanpaKunci {
+				if kunci >= 0 || periksa >= 0 {
+					t.Fatalf("jadwal tidak valid tetap mengunci atau memeriksa bentrok")
+				}
+				return
+			}
+			if kunci < 0 || periksa < kunci {
+				t.Fatalf("kunci pada query ke-%d, pemeriksaan bentrok pada query ke-%d", kunci, periksa)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Migrate membuat tabel dan kolom tambahan yang dibutuhkan aplikasi.
+// Tabel lama hanya ditambah kolom baru, struktur kolom yang sudah ada tidak diubah.
+func Migrate(db *gorm.DB) error {
+	adaDisplayRuangPoli := db.Migrator().HasTable(&DisplayRuangPoli{})
+
+	err := db.AutoMigrate(
+		&PengaturanRuangPoli{},
+		&RiwayatPanggilan{},
+		&PindahRuangPoli{},
+		&AturanPrioritas{},
+		&PrioritasPasien{},
+		&NomorAntrian{},
+		&CounterAntrian{},
+		&JedaRuangPoli{},
+		&RiwayatJedaRuangPoli{},
+		&PengaturanDisplay{},
+		&Media{},
+		&PlaylistDisplay{},
+		&RunningText{},
+		&DisplayRuangPoli{},
+		&StatusDokter{},
+		&PerangkatDisplay{},
+		&JadwalOperasiDisplay{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Pemetaan display pertama kali diisi dari kolom kd_display dan posisi_display_poli bw_ruang_poli
+	if !adaDisplayRuangPoli {
+		err := db.Exec("INSERT IGNORE INTO bw_display_ruang_poli (kd_display, kd_ruang_poli, posisi) " +
+			"SELECT kd_display, kd_ruang_poli, posisi_display_poli FROM bw_ruang_poli " +
+			"WHERE kd_display IS NOT NULL AND kd_display <> ''").Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := addColumns(db, &RuangPoli{}, "PrefixAntrian"); err != nil {
+		return err
+	}
+
+	return addColumns(db, &LogAntrianPoli{}, "JumlahPanggil", "SisaLewati", "BatasDipanggil")
+}
+
+// addColumns menambahkan kolom pada tabel model jika kolom tersebut belum ada
+func addColumns(db *gorm.DB, model interface{}, fields ...string) error {
+	migrator := db.Migrator()
+	for _, field := range fields {
+		if migrator.HasColumn(model, field) {
+			continue
+		}
+		if err := migrator.AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ type RuangPoli struct {
 	NamaRuangPoli     string   `json:"nama_ruang_poli" gorm:"column:nama_ruang_poli"`
 	KdDisplay         string   `json:"kd_display" gorm:"column:kd_display"`
 	PosisiDisplayPoli int      `json:"posisi_display_poli" gorm:"column:posisi_display_poli"`
+	PrefixAntrian     string   `json:"prefix_antrian" gorm:"column:prefix_antrian;size:5"`
 	Display           Display  `json:"display" gorm:"foreignKey:KdDisplay;references:KdDisplay"`
 	Pasien            []Pasien `json:"pasien,omitempty" gorm:"-"`
 }
@@ -30,6 +31,19 @@ func (RuangPoli) TableName() string {
 	return "bw_ruang_poli"
 }
 
+// DisplayRuangPoli mewakili model untuk tabel bw_display_ruang_poli.
+// Satu ruang poli dapat tampil pada beberapa display dengan posisi masing-masing.
+type DisplayRuangPoli struct {
+	KdDisplay   string `json:"kd_display" gorm:"column:kd_display;primaryKey;size:20"`
+	KdRuangPoli string `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;primaryKey;size:20;index"`
+	Posisi      int    `json:"posisi" gorm:"column:posisi;not null"` // Urutan ruang poli pada display
+}
+
+// TableName menentukan nama tabel untuk model DisplayRuangPoli
+func (DisplayRuangPoli) TableName() string {
+	return "bw_display_ruang_poli"
+}
+
 // Dokter mewakili model untuk tabel dokter
 type Dokter struct {
 	KdDokter string `json:"kd_dokter" gorm:"column:kd_dokter;primaryKey"`
@@ -116,9 +130,12 @@ func (RegPeriksa) TableName() string {
 
 // LogAntrianPoli mewakili model untuk tabel bw_log_antrian_poli
 type LogAntrianPoli struct {
-	NoRawat     string `json:"no_rawat" gorm:"column:no_rawat;primaryKey"`
-	KdRuangPoli string `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli"`
-	Status      string `json:"status" gorm:"column:status"`
+	NoRawat        string     `json:"no_rawat" gorm:"column:no_rawat;primaryKey"`
+	KdRuangPoli    string     `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli"`
+	Status         string     `json:"status" gorm:"column:status"`
+	JumlahPanggil  int        `json:"jumlah_panggil" gorm:"column:jumlah_panggil;not null;default:0"`
+	SisaLewati     int        `json:"sisa_lewati" gorm:"column:sisa_lewati;not null;default:0"` // Jumlah panggilan lain sebelum pasien yang dikembalikan (status=3) didahulukan
+	BatasDipanggil *time.Time `json:"batas_dipanggil" gorm:"column:batas_dipanggil"`            // Waktu status sedang dipanggil (2) berakhir
 }
 
 // TableName menentukan nama tabel untuk model LogAntrianPoli
@@ -136,3 +153,311 @@ type Penjab struct {
 func (Penjab) TableName() string {
 	return "penjab"
 }
+
+// Kebijakan pengembalian pasien terlewat ke antrian
+const (
+	KebijakanTerlewatManual  = "manual"  // Hanya dikembalikan saat diminta petugas
+	KebijakanTerlewatSetelah = "setelah" // Otomatis dikembalikan setelah N pasien berikutnya
+	KebijakanTerlewatAkhir   = "akhir"   // Otomatis dikembalikan ke akhir antrian
+)
+
+// Kebijakan penyamaran nama pasien pada display umum, diurutkan dari yang paling terbuka
+const (
+	SamaranPenuh     = "penuh"      // Nama lengkap
+	SamaranNamaDepan = "nama_depan" // Nama depan, nama lainnya disamarkan (BUDI S***)
+	SamaranInisial   = "inisial"    // Inisial saja (B. S.)
+	SamaranNomor     = "nomor"      // Hanya nomor antrian, nama tidak ditampilkan
+)
+
+// PengaturanRuangPoli mewakili model untuk tabel bw_pengaturan_ruang_poli
+type PengaturanRuangPoli struct {
+	KdRuangPoli       string `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;primaryKey;size:20"`
+	MaksPanggilan     int    `json:"maks_panggilan" gorm:"column:maks_panggilan;not null;default:3"`
+	KebijakanTerlewat string `json:"kebijakan_terlewat" gorm:"column:kebijakan_terlewat;size:10;not null;default:manual"`
+	JumlahSisip       int    `json:"jumlah_sisip" gorm:"column:jumlah_sisip;not null;default:3"`
+	BatasPanggilan    int    `json:"batas_panggilan" gorm:"column:batas_panggilan;not null;default:5"`       // Lama status sedang dipanggil dalam menit
+	SelangPrioritas   int    `json:"selang_prioritas" gorm:"column:selang_prioritas;not null;default:3"`     // Satu pasien prioritas setiap N pasien reguler, 0 = tanpa prioritas
+	SamaranNama       string `json:"samaran_nama" gorm:"column:samaran_nama;size:10;not null;default:penuh"` // Cara nama pasien ditampilkan di display umum
+}
+
+// TableName menentukan nama tabel untuk model PengaturanRuangPoli
+func (PengaturanRuangPoli) TableName() string {
+	return "bw_pengaturan_ruang_poli"
+}
+
+// RiwayatPanggilan mewakili model untuk tabel bw_riwayat_panggilan
+type RiwayatPanggilan struct {
+	ID           uint      `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	NoRawat      string    `json:"no_rawat" gorm:"column:no_rawat;size:17;index"`
+	KdRuangPoli  string    `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;size:20;index:idx_riwayat_ruang_waktu,priority:1"`
+	KdDisplay    string    `json:"kd_display" gorm:"column:kd_display;size:20"`
+	NoReg        string    `json:"no_reg" gorm:"column:no_reg;size:8"`
+	NoAntrian    string    `json:"no_antrian" gorm:"column:no_antrian;size:20"`
+	NmPasien     string    `json:"nm_pasien" gorm:"column:nm_pasien;size:40"`
+	NmPoli       string    `json:"nm_poli" gorm:"column:nm_poli;size:50"`
+	PanggilanKe  int       `json:"panggilan_ke" gorm:"column:panggilan_ke"`
+	Prioritas    bool      `json:"prioritas" gorm:"column:prioritas;not null;default:false"`
+	WaktuPanggil time.Time `json:"waktu_panggil" gorm:"column:waktu_panggil;index:idx_riwayat_ruang_waktu,priority:2"`
+}
+
+// TableName menentukan nama tabel untuk model RiwayatPanggilan
+func (RiwayatPanggilan) TableName() string {
+	return "bw_riwayat_panggilan"
+}
+
+// Posisi pasien di antrian ruang poli tujuan saat dipindahkan
+const (
+	PosisiPindahTetap = "tetap" // Mengikuti urutan antrian normal
+	PosisiPindahAwal  = "awal"  // Dipanggil paling awal
+	PosisiPindahAkhir = "akhir" // Ditempatkan di akhir antrian
+)
+
+// PindahRuangPoli mewakili model untuk tabel bw_pindah_ruang_poli
+type PindahRuangPoli struct {
+	NoRawat         string    `json:"no_rawat" gorm:"column:no_rawat;primaryKey;size:17"`
+	KdRuangPoli     string    `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;size:20;index"`
+	KdRuangPoliAsal string    `json:"kd_ruang_poli_asal" gorm:"column:kd_ruang_poli_asal;size:20"`
+	Alasan          string    `json:"alasan" gorm:"column:alasan;size:100"`
+	WaktuPindah     time.Time `json:"waktu_pindah" gorm:"column:waktu_pindah"`
+}
+
+// TableName menentukan nama tabel untuk model PindahRuangPoli
+func (PindahRuangPoli) TableName() string {
+	return "bw_pindah_ruang_poli"
+}
+
+// Jenis aturan prioritas antrian
+const (
+	PrioritasLansia      = "lansia"      // Nilai berisi umur minimal
+	PrioritasDisabilitas = "disabilitas" // Ditandai petugas per kunjungan
+	PrioritasHamil       = "hamil"       // Ditandai petugas per kunjungan
+	PrioritasPenjab      = "penjab"      // Nilai berisi kd_pj
+)
+
+// AturanPrioritas mewakili model untuk tabel bw_aturan_prioritas
+type AturanPrioritas struct {
+	ID    uint   `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	Jenis string `json:"jenis" gorm:"column:jenis;size:15"`
+	Nilai string `json:"nilai" gorm:"column:nilai;size:20"`
+}
+
+// TableName menentukan nama tabel untuk model AturanPrioritas
+func (AturanPrioritas) TableName() string {
+	return "bw_aturan_prioritas"
+}
+
+// PrioritasPasien mewakili model untuk tabel bw_prioritas_pasien
+type PrioritasPasien struct {
+	NoRawat    string `json:"no_rawat" gorm:"column:no_rawat;primaryKey;size:17"`
+	Jenis      string `json:"jenis" gorm:"column:jenis;size:15"`
+	Keterangan string `json:"keterangan" gorm:"column:keterangan;size:100"`
+}
+
+// TableName menentukan nama tabel untuk model PrioritasPasien
+func (PrioritasPasien) TableName() string {
+	return "bw_prioritas_pasien"
+}
+
+// NomorAntrian mewakili model untuk tabel bw_nomor_antrian
+type NomorAntrian struct {
+	NoRawat     string    `json:"no_rawat" gorm:"column:no_rawat;primaryKey;size:17"`
+	KdRuangPoli string    `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;size:20;uniqueIndex:idx_nomor_antrian_harian,priority:1"`
+	Tanggal     time.Time `json:"tanggal" gorm:"column:tanggal;type:date;uniqueIndex:idx_nomor_antrian_harian,priority:2"`
+	Nomor       int       `json:"nomor" gorm:"column:nomor;uniqueIndex:idx_nomor_antrian_harian,priority:3"`
+	KodeAntrian string    `json:"kode_antrian" gorm:"column:kode_antrian;size:20"`
+}
+
+// TableName menentukan nama tabel untuk model NomorAntrian
+func (NomorAntrian) TableName() string {
+	return "bw_nomor_antrian"
+}
+
+// CounterAntrian mewakili model untuk tabel bw_counter_antrian
+type CounterAntrian struct {
+	KdRuangPoli string    `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;primaryKey;size:20"`
+	Tanggal     time.Time `json:"tanggal" gorm:"column:tanggal;primaryKey;type:date"`
+	Terakhir    int       `json:"terakhir" gorm:"column:terakhir;not null;default:0"`
+}
+
+// TableName menentukan nama tabel untuk model CounterAntrian
+func (CounterAntrian) TableName() string {
+	return "bw_counter_antrian"
+}
+
+// Aksi pada riwayat jeda ruang poli
+const (
+	AksiJedaRuangPoli   = "jeda"   // Antrian ruang poli dijeda
+	AksiLanjutRuangPoli = "lanjut" // Antrian ruang poli dilanjutkan
+)
+
+// JedaRuangPoli mewakili model untuk tabel bw_jeda_ruang_poli.
+// Ruang poli yang memiliki baris pada tabel ini sedang dijeda.
+type JedaRuangPoli struct {
+	KdRuangPoli      string     `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;primaryKey;size:20"`
+	Alasan           string     `json:"alasan" gorm:"column:alasan;size:100"`
+	PerkiraanKembali *time.Time `json:"perkiraan_kembali" gorm:"column:perkiraan_kembali"`
+	Petugas          string     `json:"petugas" gorm:"column:petugas;size:50"`
+	WaktuMulai       time.Time  `json:"waktu_mulai" gorm:"column:waktu_mulai"`
+}
+
+// TableName menentukan nama tabel untuk model JedaRuangPoli
+func (JedaRuangPoli) TableName() string {
+	return "bw_jeda_ruang_poli"
+}
+
+// RiwayatJedaRuangPoli mewakili model untuk tabel bw_riwayat_jeda_ruang_poli
+type RiwayatJedaRuangPoli struct {
+	ID               uint       `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	KdRuangPoli      string     `json:"kd_ruang_poli" gorm:"column:kd_ruang_poli;size:20;index:idx_riwayat_jeda_ruang_waktu,priority:1"`
+	Aksi             string     `json:"aksi" gorm:"column:aksi;size:10"`
+	Alasan           string     `json:"alasan" gorm:"column:alasan;size:100"`
+	PerkiraanKembali *time.Time `json:"perkiraan_kembali" gorm:"column:perkiraan_kembali"`
+	Petugas          string     `json:"petugas" gorm:"column:petugas;size:50"`
+	Waktu            time.Time  `json:"waktu" gorm:"column:waktu;index:idx_riwayat_jeda_ruang_waktu,priority:2"`
+}
+
+// TableName menentukan nama tabel untuk model RiwayatJedaRuangPoli
+func (RiwayatJedaRuangPoli) TableName() string {
+	return "bw_riwayat_jeda_ruang_poli"
+}
+
+// Status kehadiran dokter pada hari praktek
+const (
+	StatusDokterBelumDatang = "belum_datang"
+	StatusDokterPraktik     = "praktik"
+	StatusDokterIstirahat   = "istirahat"
+	StatusDokterSelesai     = "selesai"
+)
+
+// StatusDokter mewakili model untuk tabel bw_status_dokter.
+// Status disimpan per tanggal sehingga setiap hari dimulai dari belum datang.
+type StatusDokter struct {
+	KdDokter   string     `json:"kd_dokter" gorm:"column:kd_dokter;primaryKey;size:20"`
+	Tanggal    time.Time  `json:"tanggal" gorm:"column:tanggal;primaryKey;type:date"`
+	Status     string     `json:"status" gorm:"column:status;size:15;not null"`
+	JamDatang  *time.Time `json:"jam_datang" gorm:"column:jam_datang"` // Pertama kali status diubah menjadi praktik
+	Keterangan string     `json:"keterangan" gorm:"column:keterangan;size:100"`
+	Petugas    string     `json:"petugas" gorm:"column:petugas;size:50"`
+	Diubah     time.Time  `json:"diubah" gorm:"column:diubah"`
+}
+
+// TableName menentukan nama tabel untuk model StatusDokter
+func (StatusDokter) TableName() string {
+	return "bw_status_dokter"
+}
+
+// Status perangkat display
+const (
+	PerangkatMenunggu = "menunggu" // Menampilkan kode pairing, belum dipasangkan ke display
+	PerangkatAktif    = "aktif"    // Sudah dipasangkan, token dapat dipakai
+	PerangkatDicabut  = "dicabut"  // Token tidak berlaku lagi
+)
+
+// PerangkatDisplay mewakili model untuk tabel bw_perangkat_display.
+// Token perangkat hanya disimpan dalam bentuk hash SHA-256.
+type PerangkatDisplay struct {
+	ID              uint       `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	Nama            string     `json:"nama" gorm:"column:nama;size:100"`
+	KdDisplay       string     `json:"kd_display" gorm:"column:kd_display;size:20;index"`
+	KodePairing     *string    `json:"kode_pairing" gorm:"column:kode_pairing;size:8;uniqueIndex"` // Dikosongkan setelah dipasangkan
+	KodeKedaluwarsa time.Time  `json:"kode_kedaluwarsa" gorm:"column:kode_kedaluwarsa"`
+	TokenHash       string     `json:"-" gorm:"column:token_hash;size:64;uniqueIndex"`
+	Status          string     `json:"status" gorm:"column:status;size:10;not null"`
+	Dibuat          time.Time  `json:"dibuat" gorm:"column:dibuat"`
+	Dipasangkan     *time.Time `json:"dipasangkan" gorm:"column:dipasangkan"`
+	Dicabut         *time.Time `json:"dicabut" gorm:"column:dicabut"`
+	TerakhirAktif   *time.Time `json:"terakhir_aktif" gorm:"column:terakhir_aktif"`
+}
+
+// TableName menentukan nama tabel untuk model PerangkatDisplay
+func (PerangkatDisplay) TableName() string {
+	return "bw_perangkat_display"
+}
+
+// PengaturanDisplay mewakili model untuk tabel bw_pengaturan_display
+type PengaturanDisplay struct {
+	KdDisplay       string  `json:"kd_display" gorm:"column:kd_display;primaryKey;size:20"`
+	PanelPerHalaman int     `json:"panel_per_halaman" gorm:"column:panel_per_halaman;not null"` // Jumlah panel ruang poli per halaman
+	IntervalRotasi  int     `json:"interval_rotasi" gorm:"column:interval_rotasi;not null"`     // Detik per halaman, 0 = tanpa rotasi
+	WarnaUtama      string  `json:"warna_utama" gorm:"column:warna_utama;size:7"`
+	WarnaLatar      string  `json:"warna_latar" gorm:"column:warna_latar;size:7"`
+	WarnaTeks       string  `json:"warna_teks" gorm:"column:warna_teks;size:7"`
+	Logo            string  `json:"logo" gorm:"column:logo;size:255"` // URL logo
+	TampilTerlewat  bool    `json:"tampil_terlewat" gorm:"column:tampil_terlewat;not null"`
+	TampilDokter    bool    `json:"tampil_dokter" gorm:"column:tampil_dokter;not null"`
+	SkalaFont       float64 `json:"skala_font" gorm:"column:skala_font;not null"`
+	SamaranNama     string  `json:"samaran_nama" gorm:"column:samaran_nama;size:10;not null;default:penuh"` // Cara nama pasien ditampilkan di display ini
+}
+
+// TableName menentukan nama tabel untuk model PengaturanDisplay
+func (PengaturanDisplay) TableName() string {
+	return "bw_pengaturan_display"
+}
+
+// Jenis media konten display
+const (
+	MediaGambar = "gambar"
+	MediaVideo  = "video"
+)
+
+// Media mewakili model untuk tabel bw_media (file gambar atau video yang diunggah)
+type Media struct {
+	ID     uint      `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	Judul  string    `json:"judul" gorm:"column:judul;size:100"`
+	Jenis  string    `json:"jenis" gorm:"column:jenis;size:10"`
+	File   string    `json:"file" gorm:"column:file;size:255"` // URL relatif file di assets/media
+	Ukuran int64     `json:"ukuran" gorm:"column:ukuran"`      // Ukuran file dalam byte
+	Dibuat time.Time `json:"dibuat" gorm:"column:dibuat"`
+}
+
+// TableName menentukan nama tabel untuk model Media
+func (Media) TableName() string {
+	return "bw_media"
+}
+
+// PlaylistDisplay mewakili model untuk tabel bw_playlist_display
+type PlaylistDisplay struct {
+	ID            uint       `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	KdDisplay     string     `json:"kd_display" gorm:"column:kd_display;size:20;index"`
+	IDMedia       uint       `json:"id_media" gorm:"column:id_media;index"`
+	Urutan        int        `json:"urutan" gorm:"column:urutan"`
+	Durasi        int        `json:"durasi" gorm:"column:durasi"` // Lama tayang gambar dalam detik, video diputar sampai selesai
+	MulaiTayang   *time.Time `json:"mulai_tayang" gorm:"column:mulai_tayang"`
+	SelesaiTayang *time.Time `json:"selesai_tayang" gorm:"column:selesai_tayang"`
+	Media         Media      `json:"media" gorm:"foreignKey:IDMedia;references:ID"`
+}
+
+// TableName menentukan nama tabel untuk model PlaylistDisplay
+func (PlaylistDisplay) TableName() string {
+	return "bw_playlist_display"
+}
+
+// RunningText mewakili model untuk tabel bw_running_text
+type RunningText struct {
+	ID            uint       `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	KdDisplay     string     `json:"kd_display" gorm:"column:kd_display;size:20;index"`
+	Teks          string     `json:"teks" gorm:"column:teks;size:500"`
+	Urutan        int        `json:"urutan" gorm:"column:urutan"`
+	MulaiTayang   *time.Time `json:"mulai_tayang" gorm:"column:mulai_tayang"`
+	SelesaiTayang *time.Time `json:"selesai_tayang" gorm:"column:selesai_tayang"`
+}
+
+// TableName menentukan nama tabel untuk model RunningText
+func (RunningText) TableName() string {
+	return "bw_running_text"
+}
+
+// JadwalOperasiDisplay mewakili model untuk tabel bw_jadwal_operasi_display.
+// Di luar jam operasi display masuk mode standby; display tanpa jadwal operasi selalu menyala.
+type JadwalOperasiDisplay struct {
+	ID        uint   `json:"id" gorm:"column:id;primaryKey;autoIncrement"`
+	KdDisplay string `json:"kd_display" gorm:"column:kd_display;size:20;index"`
+	HariKerja string `json:"hari_kerja" gorm:"column:hari_kerja;size:10"` // Nama hari dari services.GetDayList
+	JamBuka   string `json:"jam_buka" gorm:"column:jam_buka;size:5"`      // Format HH:MM
+	JamTutup  string `json:"jam_tutup" gorm:"column:jam_tutup;size:5"`    // Format HH:MM
+}
+
+// TableName menentukan nama tabel untuk model JadwalOperasiDisplay
+func (JadwalOperasiDisplay) TableName() string {
+	return "bw_jadwal_operasi_display"
+}
@@ -1,6 +1,9 @@
 package services
 
-import "os"
+import (
+	"os"
+	"strconv"
+)
 
 // ValueENV menyediakan fungsi untuk mengakses nilai variabel lingkungan
 type ValueENV struct{}
@@ -19,3 +22,49 @@ func GetPusherCluster() string {
 func GetAppURL() string {
 	return os.Getenv("APP_URL")
 }
+
+// GetMaksPanggilan mengembalikan batas default jumlah panggilan sebelum pasien dianggap terlewat
+func GetMaksPanggilan() int {
+	return getEnvInt("MAKS_PANGGILAN", 3)
+}
+
+// GetBatasPanggilan mengembalikan lama default status sedang dipanggil dalam menit
+func GetBatasPanggilan() int {
+	return getEnvInt("BATAS_PANGGILAN", 5)
+}
+
+// GetRataPelayanan mengembalikan perkiraan default lama pelayanan satu pasien dalam menit,
+// dipakai untuk estimasi waktu tunggu saat riwayat panggilan hari ini belum cukup
+func GetRataPelayanan() int {
+	return getEnvInt("RATA_PELAYANAN", 10)
+}
+
+// GetWajibTokenDisplay menentukan apakah halaman, API, dan WebSocket display hanya dapat dibuka
+// oleh perangkat yang sudah dipasangkan. Default aktif, isi false selama masa peralihan.
+func GetWajibTokenDisplay() bool {
+	return getEnvBool("WAJIB_TOKEN_DISPLAY", true)
+}
+
+// GetAdminToken mengembalikan token admin untuk API pengelolaan perangkat display.
+// Kosong berarti API tersebut ditutup sampai ADMIN_TOKEN diisi.
+func GetAdminToken() string {
+	return os.Getenv("ADMIN_TOKEN")
+}
+
+// getEnvBool membaca variabel lingkungan sebagai boolean, atau nilai default jika kosong/tidak valid
+func getEnvBool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvInt membaca variabel lingkungan sebagai bilangan bulat, atau nilai default jika kosong/tidak valid
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
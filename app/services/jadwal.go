@@ -0,0 +1,76 @@
+package services
+
+import (
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Sumber jadwal dokter
+const (
+	SumberJadwalKhanza = "khanza" // Tabel jadwal milik SIMRS Khanza
+	SumberJadwalLokal  = "lokal"  // Tabel bw_jadwal_dokter yang diubah melalui halaman jadwal dokter
+)
+
+// tabelSumberJadwal memetakan sumber jadwal ke nama tabelnya
+var tabelSumberJadwal = map[string]string{
+	SumberJadwalKhanza: "jadwal",
+	SumberJadwalLokal:  "bw_jadwal_dokter",
+}
+
+// GetSumberJadwal mengembalikan urutan sumber jadwal dokter dari variabel SUMBER_JADWAL, misalnya
+// "lokal,khanza". Untuk setiap dokter dan hari dipakai jadwal dari sumber pertama yang memilikinya.
+// Sumber yang tidak dikenal diabaikan; default khanza.
+func GetSumberJadwal() []string {
+	var urutan []string
+	ada := make(map[string]bool)
+	for _, sumber := range strings.Split(os.Getenv("SUMBER_JADWAL"), ",") {
+		sumber = strings.ToLower(strings.TrimSpace(sumber))
+		if _, ok := tabelSumberJadwal[sumber]; ok && !ada[sumber] {
+			ada[sumber] = true
+			urutan = append(urutan, sumber)
+		}
+	}
+	if len(urutan) == 0 {
+		return []string{SumberJadwalKhanza}
+	}
+	return urutan
+}
+
+// SumberJadwalDipakai menentukan apakah sumber jadwal termasuk dalam SUMBER_JADWAL
+func SumberJadwalDipakai(sumber string) bool {
+	for _, s := range GetSumberJadwal() {
+		if s == sumber {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryJadwalDokter membangun subquery jadwal dokter dari sumber jadwal yang dikonfigurasi dengan kolom
+// kd_dokter, hari_kerja, jam_mulai, jam_selesai, kd_poli, dan sumber (khanza atau lokal; hanya jadwal
+// lokal yang dapat diubah melalui halaman jadwal dokter). Gunakan dengan alias jadwal, misalnya
+// Joins("JOIN (?) AS jadwal ON ...", services.QueryJadwalDokter(db)), agar semua handler membaca jadwal yang sama.
+func QueryJadwalDokter(db *gorm.DB) *gorm.DB {
+	urutan := GetSumberJadwal()
+
+	bagian := make([]string, 0, len(urutan))
+	for i, sumber := range urutan {
+		sql := "SELECT j.kd_dokter, j.hari_kerja, j.jam_mulai, j.jam_selesai, j.kd_poli, '" + sumber + "' AS sumber " +
+			"FROM " + tabelSumberJadwal[sumber] + " AS j"
+
+		// Lewati jadwal dokter pada hari yang sudah diatur oleh sumber sebelumnya
+		var kecuali []string
+		for _, lebihDulu := range urutan[:i] {
+			kecuali = append(kecuali, "NOT EXISTS (SELECT 1 FROM "+tabelSumberJadwal[lebihDulu]+" AS o "+
+				"WHERE o.kd_dokter = j.kd_dokter AND o.hari_kerja = j.hari_kerja)")
+		}
+		if len(kecuali) > 0 {
+			sql += " WHERE " + strings.Join(kecuali, " AND ")
+		}
+		bagian = append(bagian, sql)
+	}
+
+	return db.Session(&gorm.Session{NewDB: true}).Raw(strings.Join(bagian, " UNION ALL "))
+}
@@ -16,6 +16,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/dhiafahmig/Go-DisplayPoli/app/handlers"
+	"github.com/dhiafahmig/Go-DisplayPoli/app/models"
 )
 
 var (
@@ -23,15 +24,16 @@ var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		Subprotocols:    []string{handlers.SubprotokolDisplay}, // Token perangkat dikirim sebagai subprotokol kedua
 		CheckOrigin: func(r *http.Request) bool {
 			// Log origin untuk debugging
 			origin := r.Header.Get("Origin")
 			log.Printf("WebSocket connection request from Origin: %s", origin)
-			return true // Allow all origins for WebSocket
+			return true // Origin tidak dibatasi, akses display dibatasi token perangkat (WajibToken)
 		},
 	}
-	clients     = make(map[*websocket.Conn]bool)
-	broadcaster = make(chan handlers.PanggilPoliMessage)
+	broadcaster   = make(chan handlers.PanggilPoliMessage)
+	displaySocket *handlers.DisplaySocketHub
 )
 
 func init() {
@@ -55,6 +57,11 @@ func init() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+
+	// Siapkan tabel dan kolom tambahan
+	if err := models.Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 }
 
 func main() {
@@ -76,8 +83,8 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -88,14 +95,56 @@ func main() {
 	settingPoliHandler := handlers.NewSettingPoliHandler(db)
 	settingPosisiDokterHandler := handlers.NewSettingPosisiDokterHandler(db)
 	jadwalDokterHandler := handlers.NewJadwalDokterHandler(db)
+	prioritasHandler := handlers.NewPrioritasHandler(db)
+	jedaRuangPoliHandler := handlers.NewJedaRuangPoliHandler(db)
+	kontenDisplayHandler := handlers.NewKontenDisplayHandler(db)
+	statusDokterHandler := handlers.NewStatusDokterHandler(db)
+	perangkatDisplayHandler := handlers.NewPerangkatDisplayHandler(db)
+	jadwalOperasiDisplayHandler := handlers.NewJadwalOperasiDisplayHandler(db)
 	panggilPoliHandler := handlers.NewPanggilPoliHandler(db)
+	displaySocket = displayPoliHandler.Socket
 	panggilPoliHandler.SetBroadcaster(broadcaster)
 
-	// Memulai broadcaster
+	// Snapshot display ditandai berubah oleh kejadian antrian dan perubahan pengaturan
+	panggilPoliHandler.SetSnapshotCache(displayPoliHandler.Snapshot)
+	panggilPoliHandler.SetSocketHub(displayPoliHandler.Socket)
+	jedaRuangPoliHandler.SetSnapshotCache(displayPoliHandler.Snapshot)
+	statusDokterHandler.SetSnapshotCache(displayPoliHandler.Snapshot)
+	settingDisplayPoliHandler.SetSocketHub(displayPoliHandler.Socket)
+	kontenDisplayHandler.SetSocketHub(displayPoliHandler.Socket)
+	perangkatDisplayHandler.SetSocketHub(displayPoliHandler.Socket)
+	jadwalOperasiDisplayHandler.SetSocketHub(displayPoliHandler.Socket)
+	snapshotBerubah := displayPoliHandler.Snapshot.Middleware()
+
+	// Simpan response panggilan dan log selama 10 menit untuk header Idempotency-Key
+	idempotency := handlers.NewIdempotencyStore(10 * time.Minute).Middleware()
+
+	// Memulai broadcaster dan pengiriman snapshot display
 	go handleMessages()
+	go displaySocket.Jalankan()
+
+	// Memulai pembersih status panggilan yang kedaluwarsa
+	go panggilPoliHandler.MulaiPembersihPanggilan(30 * time.Second)
+
+	// Memulai penomoran antrian pasien yang baru terdaftar
+	go panggilPoliHandler.MulaiPenomoranAntrian(10 * time.Second)
+
+	// Memulai penyegaran snapshot display untuk menampilkan pendaftaran pasien baru
+	go displayPoliHandler.Snapshot.MulaiPenyegaran(30 * time.Second)
+
+	// Memulai pengiriman konten display yang mulai atau selesai tayang
+	go kontenDisplayHandler.MulaiPenjadwalanKonten(time.Minute)
+
+	// Memulai pengiriman status standby display yang masuk atau keluar dari jam operasi
+	go jadwalOperasiDisplayHandler.MulaiPenjadwalanOperasi(time.Minute)
+
+	// API dan WebSocket display hanya untuk perangkat yang sudah dipasangkan. Token dikirim pada header
+	// Authorization: Bearer, atau sebagai subprotokol token.<token> untuk WebSocket. Halaman display
+	// tidak memuat data pasien dan membaca token dari local storage untuk permintaan tersebut.
+	wajibToken := perangkatDisplayHandler.WajibToken()
 
 	// Rutekan API Halaman
-	r.GET("/ws/:kd_display", handleWebsocket)
+	r.GET("/ws/:kd_display", wajibToken, handleWebsocket)
 	r.GET("/ws/antrian/:kd_ruang_poli", panggilPoliHandler.HandleAntrianWebSocket)
 	r.GET("/display/:kd_display", displayPoliHandler.HandleDisplay)
 	r.GET("/settings/display", settingDisplayPoliHandler.HandleSettings)
@@ -105,7 +154,8 @@ func main() {
 	r.GET("/panggilpoli/:kd_ruang_poli/:kd_display", panggilPoliHandler.HandlePanggil)
 
 	// API untuk aplikasi React
-	r.GET("/api/display/poli/:kd_display", displayPoliHandler.GetPoliListByDisplay)
+	r.GET("/api/display/poli/:kd_display", wajibToken, displayPoliHandler.GetPoliListByDisplay)
+	r.GET("/api/display/panggilan/:kd_display", wajibToken, displayPoliHandler.GetPanggilanTerakhir)
 	r.GET("/api/panggil/:kd_ruang_poli", panggilPoliHandler.HandlePanggilAPI)
 	r.GET("/api/antrian/poli/:kd_ruang_poli", panggilPoliHandler.HandleAntrianPoliAPI)
 	r.GET("/api/jadwal/dokter/all", jadwalDokterHandler.GetJadwalDokter) // Route baru untuk mendapatkan jadwal dokter
@@ -113,46 +163,115 @@ func main() {
 	// API untuk pengaturan display
 	displayGroup := r.Group("/api/display")
 	{
+		displayGroup.Use(snapshotBerubah)
 		displayGroup.GET("/", settingDisplayPoliHandler.GetAllDisplay)
 		displayGroup.POST("/", settingDisplayPoliHandler.AddDisplay)
 		displayGroup.PUT("/", settingDisplayPoliHandler.EditDisplay)
 		displayGroup.DELETE("/:kd_display", settingDisplayPoliHandler.DeleteDisplay)
+		displayGroup.GET("/layout/:kd_display", settingDisplayPoliHandler.GetLayoutDisplay)
+		displayGroup.PUT("/layout/:kd_display", settingDisplayPoliHandler.SimpanLayoutDisplay)
+		displayGroup.GET("/operasi/:kd_display", jadwalOperasiDisplayHandler.GetJadwalOperasi)
+		displayGroup.PUT("/operasi/:kd_display", jadwalOperasiDisplayHandler.SimpanJadwalOperasi)
+	}
+
+	// API untuk pairing dan pencabutan perangkat display. Perangkat meminta kode pairing dan
+	// memeriksa statusnya tanpa login; memasangkan, melihat, dan mencabut perangkat hanya untuk admin.
+	wajibAdmin := handlers.WajibAdmin()
+	perangkatGroup := r.Group("/api/perangkat")
+	{
+		perangkatGroup.GET("/", wajibAdmin, perangkatDisplayHandler.GetAllPerangkat)
+		perangkatGroup.POST("/pairing", perangkatDisplayHandler.MintaPairing)
+		perangkatGroup.GET("/status", perangkatDisplayHandler.StatusPerangkat)
+		perangkatGroup.POST("/pasangkan", wajibAdmin, perangkatDisplayHandler.PasangkanPerangkat)
+		perangkatGroup.DELETE("/:id", wajibAdmin, perangkatDisplayHandler.CabutPerangkat)
+	}
+
+	// API untuk media konten display
+	mediaGroup := r.Group("/api/media")
+	{
+		mediaGroup.GET("/", kontenDisplayHandler.GetAllMedia)
+		mediaGroup.POST("/", kontenDisplayHandler.UploadMedia)
+		mediaGroup.DELETE("/:id", kontenDisplayHandler.DeleteMedia)
+	}
+
+	// API untuk playlist media per display
+	playlistGroup := r.Group("/api/playlist")
+	{
+		playlistGroup.GET("/:kd_display", kontenDisplayHandler.GetPlaylist)
+		playlistGroup.POST("/:kd_display", kontenDisplayHandler.TambahPlaylist)
+		playlistGroup.PUT("/:kd_display/:id", kontenDisplayHandler.UbahPlaylist)
+		playlistGroup.DELETE("/:kd_display/:id", kontenDisplayHandler.HapusPlaylist)
+	}
+
+	// API untuk running text per display
+	runningTextGroup := r.Group("/api/runningtext")
+	{
+		runningTextGroup.GET("/:kd_display", kontenDisplayHandler.GetRunningText)
+		runningTextGroup.POST("/:kd_display", kontenDisplayHandler.TambahRunningText)
+		runningTextGroup.PUT("/:kd_display/:id", kontenDisplayHandler.UbahRunningText)
+		runningTextGroup.DELETE("/:kd_display/:id", kontenDisplayHandler.HapusRunningText)
 	}
 
 	// API untuk pengaturan poli
 	poliGroup := r.Group("/api/poli")
 	{
+		poliGroup.Use(snapshotBerubah)
 		poliGroup.GET("/", settingPoliHandler.GetAllPoli)
 		poliGroup.POST("/", settingPoliHandler.AddPoli)
 		poliGroup.PUT("/", settingPoliHandler.EditPoli)
 		poliGroup.DELETE("/:kd_ruang_poli", settingPoliHandler.DeletePoli)
 		poliGroup.GET("/dokter/:kd_ruang_poli", settingPoliHandler.GetDokterPoli)
+		poliGroup.GET("/pengaturan/:kd_ruang_poli", settingPoliHandler.GetPengaturanPoli)
+		poliGroup.PUT("/pengaturan/:kd_ruang_poli", settingPoliHandler.SimpanPengaturanPoli)
 	}
 
 	// API untuk pengaturan posisi dokter
 	dokterPoliGroup := r.Group("/api/dokterpoli")
 	{
+		dokterPoliGroup.Use(snapshotBerubah)
 		dokterPoliGroup.POST("/", settingPosisiDokterHandler.EditPoliDokter)
 	}
 
 	// API untuk jadwal dokter
 	jadwalGroup := r.Group("/api/jadwal")
 	{
+		jadwalGroup.Use(snapshotBerubah)
 		jadwalGroup.GET("/dokter", jadwalDokterHandler.CariDokter)
+		jadwalGroup.GET("/bentrok", jadwalDokterHandler.GetBentrokJadwal)
 		jadwalGroup.POST("/", jadwalDokterHandler.TambahJadwalDokter)
 		jadwalGroup.PUT("/", jadwalDokterHandler.UbahJadwalDokter)
 		jadwalGroup.DELETE("/", jadwalDokterHandler.HapusJadwalDokter)
 	}
 
-	// API untuk antrian pasien
-	r.POST("/api/panggilpoli", panggilPoliHandler.PanggilPasien)
-	r.POST("/api/panggilpasien", panggilPoliHandler.PanggilPasien)
-	r.POST("/api/antrian/panggil", panggilPoliHandler.PanggilPasienAPI)
+	// API untuk aturan prioritas antrian
+	prioritasGroup := r.Group("/api/prioritas")
+	{
+		prioritasGroup.Use(snapshotBerubah)
+		prioritasGroup.GET("/", prioritasHandler.GetAturanPrioritas)
+		prioritasGroup.POST("/", prioritasHandler.TambahAturanPrioritas)
+		prioritasGroup.DELETE("/:id", prioritasHandler.HapusAturanPrioritas)
+	}
 
-	r.POST("/api/log", panggilPoliHandler.HandleLog)
+	// API untuk antrian pasien
+	r.POST("/api/panggilpoli", idempotency, panggilPoliHandler.PanggilPasien)
+	r.POST("/api/panggilpasien", idempotency, panggilPoliHandler.PanggilPasien)
+	r.POST("/api/antrian/panggil", idempotency, panggilPoliHandler.PanggilPasienAPI)
+	r.POST("/api/antrian/:kd_ruang_poli/next", idempotency, panggilPoliHandler.PanggilBerikutnya)
+	r.POST("/api/antrian/:kd_ruang_poli/recall", idempotency, panggilPoliHandler.PanggilUlang)
+	r.GET("/api/antrian/:kd_ruang_poli/jeda", jedaRuangPoliHandler.GetJedaRuangPoli)
+	r.POST("/api/antrian/:kd_ruang_poli/jeda", idempotency, jedaRuangPoliHandler.JedaRuangPoli)
+	r.POST("/api/antrian/:kd_ruang_poli/lanjut", idempotency, jedaRuangPoliHandler.LanjutRuangPoli)
+	r.GET("/api/antrian/:kd_ruang_poli/dokter", statusDokterHandler.GetStatusDokter)
+	r.POST("/api/antrian/:kd_ruang_poli/dokter", idempotency, statusDokterHandler.UbahStatusDokter)
+	r.POST("/api/antrian/pindah", idempotency, panggilPoliHandler.PindahRuangPoliAPI)
+	r.POST("/api/antrian/prioritas", snapshotBerubah, prioritasHandler.TandaiPrioritasPasien)
+	r.DELETE("/api/antrian/prioritas/:no_rawat", snapshotBerubah, prioritasHandler.HapusPrioritasPasien)
+
+	r.POST("/api/log", idempotency, panggilPoliHandler.HandleLog)
 	r.POST("/api/log/reset/:no_rawat", panggilPoliHandler.ResetLog)
-	r.POST("/api/antrian/log", panggilPoliHandler.HandleLogAPI)
+	r.POST("/api/antrian/log", idempotency, panggilPoliHandler.HandleLogAPI)
 	r.POST("/api/antrian/log/reset/:no_rawat", panggilPoliHandler.ResetLogAPI)
+	r.POST("/api/antrian/log/requeue/:no_rawat", panggilPoliHandler.KembalikanAntrianAPI)
 
 	// Serve aplikasi React
 	r.NoRoute(func(c *gin.Context) {
@@ -179,9 +298,8 @@ func main() {
 func handleWebsocket(c *gin.Context) {
 	kdDisplay := c.Param("kd_display")
 
-	// Log headers untuk debugging
+	// Header tidak dicatat karena memuat token perangkat
 	log.Printf("WebSocket connection attempt for display: %s", kdDisplay)
-	log.Printf("Headers: %+v", c.Request.Header)
 
 	// Mencoba upgrade dengan error handling yang lebih baik
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -199,8 +317,6 @@ func handleWebsocket(c *gin.Context) {
 		log.Printf("WebSocket connection closed for %s", remoteAddr)
 	}()
 
-	clients[conn] = true
-
 	// Send initial message to confirm connection
 	initialMsg := handlers.PanggilPoliMessage{
 		KdDisplay:   kdDisplay,
@@ -213,12 +329,15 @@ func handleWebsocket(c *gin.Context) {
 		log.Printf("Error sending initial message: %v", err)
 	}
 
+	// Daftarkan koneksi agar menerima pesan panggilan dan snapshot display
+	displaySocket.Daftarkan(conn, kdDisplay, handlers.IDPerangkat(c))
+	defer displaySocket.Lepaskan(conn)
+
 	for {
 		// Keep connection alive
 		_, _, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket connection closed for %s: %v", remoteAddr, err)
-			delete(clients, conn)
 			break
 		}
 	}
@@ -228,14 +347,6 @@ func handleMessages() {
 	for {
 		msg := <-broadcaster
 		log.Printf("Broadcasting message for display %s, poli %s", msg.KdDisplay, msg.KdRuangPoli)
-
-		for client := range clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				log.Printf("Error broadcasting message: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
+		displaySocket.KirimKeDisplay(msg.KdDisplay, msg)
 	}
 }